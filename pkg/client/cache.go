@@ -0,0 +1,174 @@
+package client
+
+import (
+	"container/list"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// Maximum number of samples held by the timeseries cache, all entries included.
+const timeseriesCacheSize = 2_000_000
+
+type CacheStatistics struct {
+	Hits            int64 `json:"hits"`
+	Misses          int64 `json:"misses"`
+	PartitionHits   int64 `json:"partitionHits"`
+	PartitionMisses int64 `json:"partitionMisses"`
+	Entries         int   `json:"entries"`
+	Samples         int   `json:"samples"`
+	MaxSamples      int   `json:"maxSamples"`
+}
+
+// timeseriesCache is a least-recently-used cache of query results and of closed yearmonth partitions,
+// bounded by the total number of samples.
+type timeseriesCache struct {
+	mutex      sync.Mutex
+	maxSamples int
+	samples    int
+	entries    map[string]*list.Element
+	lru        *list.List
+	statistics CacheStatistics
+}
+
+type cacheEntry struct {
+	key     string
+	data    []model.TsPair
+	expires time.Time // zero time for entries that never expires.
+}
+
+func newTimeseriesCache(maxSamples int) *timeseriesCache {
+	return &timeseriesCache{
+		maxSamples: maxSamples,
+		entries:    make(map[string]*list.Element),
+		lru:        list.New(),
+	}
+}
+
+func (c *timeseriesCache) getResult(key string) ([]model.TsPair, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, found := c.get(key)
+	if found {
+		c.statistics.Hits++
+	} else {
+		c.statistics.Misses++
+	}
+	return data, found
+}
+
+func (c *timeseriesCache) getPartition(key string) ([]model.TsPair, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	data, found := c.get(key)
+	if found {
+		c.statistics.PartitionHits++
+	} else {
+		c.statistics.PartitionMisses++
+	}
+	return data, found
+}
+
+// put stores a copy of the data. A ttl of zero means that the entry is only evicted when the cache is full.
+func (c *timeseriesCache) put(key string, data []model.TsPair, ttl time.Duration) {
+	if len(data) > c.maxSamples {
+		return
+	}
+	entry := &cacheEntry{key: key, data: slices.Clone(data)}
+	if ttl > 0 {
+		entry.expires = time.Now().Add(ttl)
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if element, found := c.entries[key]; found {
+		c.remove(element)
+	}
+	c.entries[key] = c.lru.PushFront(entry)
+	c.samples = c.samples + len(entry.data)
+	for c.samples > c.maxSamples {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *timeseriesCache) Statistics() CacheStatistics {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	statistics := c.statistics
+	statistics.Entries = len(c.entries)
+	statistics.Samples = c.samples
+	statistics.MaxSamples = c.maxSamples
+	return statistics
+}
+
+func (c *timeseriesCache) get(key string) ([]model.TsPair, bool) {
+	element, found := c.entries[key]
+	if !found {
+		return nil, false
+	}
+	entry := element.Value.(*cacheEntry)
+	if !entry.expires.IsZero() && time.Now().After(entry.expires) {
+		c.remove(element)
+		return nil, false
+	}
+	c.lru.MoveToFront(element)
+	return slices.Clone(entry.data), true
+}
+
+func (c *timeseriesCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cacheEntry)
+	delete(c.entries, entry.key)
+	c.samples = c.samples - len(entry.data)
+}
+
+// Maximum number of datapoints held by the settings cache.
+const settingsCacheSize = 100_000
+
+// How long the datapoint and project settings are used before they are read again.
+const settingsCacheTTL = time.Minute
+
+// seriesSettings is what a timeseries query needs from the datapoint and the project.
+type seriesSettings struct {
+	datapoint model.DatapointSettings
+	location  *time.Location
+	expires   time.Time
+}
+
+// settingsCache keeps the settings of recently queried datapoints, so that a cached result is found without
+// a round trip to Cassandra.
+type settingsCache struct {
+	mutex   sync.Mutex
+	entries map[string]seriesSettings
+}
+
+func newSettingsCache() *settingsCache {
+	return &settingsCache{entries: make(map[string]seriesSettings)}
+}
+
+func (c *settingsCache) get(key string) (seriesSettings, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	settings, found := c.entries[key]
+	if !found || time.Now().After(settings.expires) {
+		return seriesSettings{}, false
+	}
+	return settings, true
+}
+
+func (c *settingsCache) put(key string, settings seriesSettings) {
+	settings.expires = time.Now().Add(settingsCacheTTL)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if len(c.entries) >= settingsCacheSize {
+		for key, entry := range c.entries {
+			if time.Now().After(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		if len(c.entries) >= settingsCacheSize {
+			clear(c.entries)
+		}
+	}
+	c.entries[key] = settings
+}
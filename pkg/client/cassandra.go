@@ -16,17 +16,20 @@ import (
 )
 
 type Cassandra interface {
-	QueryTimeseries(org int64, sensor model.QueryRef, from time.Time, to time.Time, maxValue int) *[]model.TsPair
-	QueryKeyValues(org int64, typename string, key string) (model.KeyValuesEntry, error)
+	QueryTimeseries(ctx context.Context, org int64, sensor model.QueryRef, from time.Time, to time.Time, maxValue int) (*[]model.TsPair, error)
+	QueryKeyValues(ctx context.Context, org int64, typename string, key string) (model.KeyValuesEntry, error)
 	QueryAllKeyValues(org int64, typename string) ([]model.KeyValuesEntry, error)
-	QueryAlarmStates(org int64, sensor model.QueryRef) ([]model.TsPair, error)
-	FindAllProjects(org int64) ([]model.ProjectSettings, error)
-	FindAllSubsystems(org int64, projectName string) ([]model.SubsystemSettings, error)
-	FindAllDatapoints(org int64, projectName string, subsystemName string) ([]model.DatapointSettings, error)
+	QueryAlarmStates(ctx context.Context, org int64, sensor model.QueryRef, from time.Time, to time.Time) ([]model.AlarmState, error)
+	QueryTimeOfUse(ctx context.Context, org int64, sensor model.QueryRef, from time.Time, to time.Time) (model.TariffSchedule, []model.TimeOfUse, error)
+	FindAllProjects(ctx context.Context, org int64) ([]model.ProjectSettings, error)
+	FindAllSubsystems(ctx context.Context, org int64, projectName string) ([]model.SubsystemSettings, error)
+	FindAllDatapoints(ctx context.Context, org int64, projectName string, subsystemName string) ([]model.DatapointSettings, error)
 	GetOrganization(orgId int64) (model.OrganizationSettings, error)
-	GetProject(orgId int64, name string) (model.ProjectSettings, error)
+	GetProject(ctx context.Context, orgId int64, name string) (model.ProjectSettings, error)
 	GetSubsystem(org int64, projectName string, subsystem string) (model.SubsystemSettings, error)
-	GetDatapoint(org int64, projectName string, subsystemName string, datapoint string) (model.DatapointSettings, error)
+	GetDatapoint(ctx context.Context, org int64, projectName string, subsystemName string, datapoint string) (model.DatapointSettings, error)
+	SelectAllInJournal(org int64, journaltype string, journalname string) (model.Journal, error)
+	SelectRangeInJournal(ctx context.Context, org int64, journaltype string, journalname string, from time.Time, to time.Time) (model.Journal, error)
 
 	Shutdown()
 	Reinitialize()
@@ -39,6 +42,8 @@ type CassandraClient struct {
 	session       *gocql.Session
 	err           error
 	ctx           context.Context
+	cache         *timeseriesCache
+	settings      *settingsCache
 }
 
 func (cass *CassandraClient) InitializeCassandra(hosts []string) {
@@ -47,6 +52,8 @@ func (cass *CassandraClient) InitializeCassandra(hosts []string) {
 	cass.clusterConfig.Keyspace = "ks_sensetif"
 	cass.clusterConfig.Hosts = hosts
 	cass.clusterConfig.Port = 9042
+	cass.cache = newTimeseriesCache(timeseriesCacheSize)
+	cass.settings = newSettingsCache()
 	cass.clusterConfig.HostFilter = gocql.HostFilterFunc(func(host *gocql.HostInfo) bool {
 		log.DefaultLogger.Info("Filter: " + host.ConnectAddress().String() + ":" + strconv.Itoa(host.Port()) + " --> " + host.String())
 		return true
@@ -71,56 +78,288 @@ func (cass *CassandraClient) Reinitialize() {
 	log.DefaultLogger.With("session", cass.session).Info("Cassandra session")
 }
 
-func (cass *CassandraClient) QueryTimeseries(org int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) *[]model.TsPair {
+func (cass *CassandraClient) QueryTimeseries(ctx context.Context, org int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) (*[]model.TsPair, error) {
 	log.DefaultLogger.Info("queryTimeseries:  " + strconv.FormatInt(org, 10) + "/" + query.Project + "/" + query.Subsystem + "/" + query.Datapoint + "   " + from.Format(time.RFC3339) + "->" + to.Format(time.RFC3339))
-	project, _ := cass.GetProject(org, query.Project)
-	location := createLocation(project.Timezone)
+	if query.TimeShift != "" {
+		return cass.queryShifted(ctx, org, query, from, to, maxValues)
+	}
+	settings, err := cass.seriesSettingsOf(ctx, org, query)
+	if err != nil {
+		return nil, err
+	}
+	datapoint, location := settings.datapoint, settings.location
+	// The time range is widened to the poll interval on the wall clock of the project, so that the refreshes
+	// of a relative time range find the result of the previous one until the next poll. The result is cut to
+	// the requested range after the lookup.
+	step := max(datapoint.Interval.Duration(), time.Minute)
+	alignedFrom := alignDuration(&from, location, step)
+	alignedTo := alignDuration(&to, location, step)
+	if alignedTo.Before(to) {
+		alignedTo = alignedTo.Add(step)
+	}
+	aggregation := strings.TrimSpace(query.Aggregation)
+	degreeDays := isDegreeDays(aggregation)
+	bucketed := degreeDays || (query.TimeModel != "" && aggregation != "" && aggregation != "sample")
+	// No new values should show up until the next poll, so the result is kept for one poll interval.
+	ttl := min(step, partitionCacheTTL)
+	cacheKey := resultCacheKey(org, query, alignedFrom, alignedTo, maxValues)
+	if cached, found := cass.cache.getResult(cacheKey); found {
+		return cutToRange(cached, from, to, bucketed), nil
+	}
+	requestedFrom, requestedTo := from, to
+	from, to = alignedFrom, alignedTo
+
+	if !degreeDays {
+		if err := checkAggregation(aggregation); err != nil {
+			return nil, err
+		}
+	}
+
+	// Time model buckets are reduced as the partitions arrive, unless a transform needs the whole series.
+	var reducer *intervalReducer
+	if query.Transform == "" && aggregation != "" && aggregation != "sample" && query.TimeModel != "" && !degreeDays {
+		inRange, align, err := timeModelFuncs(query.TimeModel)
+		if err != nil {
+			return nil, err
+		}
+		reducer = newIntervalReducer(inRange, align, aggregation, location)
+	}
 	var result []model.TsPair
+	err = cass.readPartitions(ctx, org, query, from, to, func(partition []model.TsPair) {
+		if reducer != nil {
+			reducer.add(partition)
+		} else {
+			result = append(result, partition...)
+		}
+	})
+	if err != nil {
+		// Partial data is worse than no data, e.g. for alerting.
+		log.DefaultLogger.Error("Internal Error 2? Failed to read record", err)
+		return nil, fmt.Errorf("read timeseries: %w", err)
+	}
+
+	var reduced *[]model.TsPair
+	if reducer != nil {
+		reduced = reducer.finish()
+	} else {
+		transformed, err := transform(&result, query.Transform, query.TransformUnit, query.CounterMax)
+		if err != nil {
+			return nil, err
+		}
+		if degreeDays {
+			reduced, err = degreeDaysOf(transformed, aggregation, query.BaseTemperature, query.TimeModel, from, to, location)
+		} else {
+			reduced, err = reduceSize(maxValues, transformed, aggregation, query.TimeModel, query.Downsample, location)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if query.Fill != "" && query.Fill != "none" {
+		bucketModel := query.TimeModel
+		if aggregation == "" || aggregation == "sample" {
+			bucketModel = "" // the time model is only used for aggregations
+		} else if degreeDays && bucketModel == "" {
+			bucketModel = "daily"
+		}
+		reduced, err = fillGaps(reduced, query.Fill, bucketModel, datapoint.Interval.Duration(), location)
+		if err != nil {
+			return nil, err
+		}
+	}
+	cass.cache.put(cacheKey, *reduced, ttl)
+	return cutToRange(*reduced, requestedFrom, requestedTo, bucketed), nil
+}
+
+// seriesSettingsOf returns the settings of the datapoint and the location of its project, from the settings
+// cache when they were read recently.
+func (cass *CassandraClient) seriesSettingsOf(ctx context.Context, org int64, query model.QueryRef) (seriesSettings, error) {
+	key := fmt.Sprintf("%d/%s/%s/%s", org, query.Project, query.Subsystem, query.Datapoint)
+	if settings, found := cass.settings.get(key); found {
+		return settings, nil
+	}
+	datapoint, err := cass.GetDatapoint(ctx, org, query.Project, query.Subsystem, query.Datapoint)
+	if err != nil {
+		return seriesSettings{}, err
+	}
+	if datapoint.Name == "" {
+		return seriesSettings{}, fmt.Errorf("%w: datapoint %s/%s/%s", model.ErrNotFound, query.Project, query.Subsystem, query.Datapoint)
+	}
+	project, err := cass.GetProject(ctx, org, query.Project)
+	if err != nil {
+		return seriesSettings{}, err
+	}
+	settings := seriesSettings{datapoint: datapoint, location: CreateLocation(project.Timezone)}
+	cass.settings.put(key, settings)
+	return settings, nil
+}
+
+// cutToRange returns the samples of data within [from,to]. Buckets are kept from the one that from falls in,
+// i.e. the last one that starts at or before from. The data may be in either order.
+func cutToRange(data []model.TsPair, from time.Time, to time.Time, bucketed bool) *[]model.TsPair {
+	start := from
+	if bucketed {
+		var first time.Time
+		for _, tsPair := range data {
+			if !tsPair.TS.After(from) && tsPair.TS.After(first) {
+				first = tsPair.TS
+			}
+		}
+		if !first.IsZero() {
+			start = first
+		}
+	}
+	result := make([]model.TsPair, 0, len(data))
+	for _, tsPair := range data {
+		if !tsPair.TS.Before(start) && !tsPair.TS.After(to) {
+			result = append(result, tsPair)
+		}
+	}
+	return &result
+}
+
+// Number of yearmonth partitions that are read concurrently for a single query.
+const partitionReaders = 4
+
+// readPartitions reads the yearmonth partitions of the time range concurrently, and passes them to consume
+// in chronological order, as soon as all earlier partitions have been consumed. No more partitions are
+// consumed after a failing one, or after the context is done.
+func (cass *CassandraClient) readPartitions(ctx context.Context, org int64, query model.QueryRef, from time.Time, to time.Time, consume func([]model.TsPair)) error {
 	startYearMonth := from.Year()*12 + int(from.Month()) - 1
 	endYearMonth := to.Year()*12 + int(to.Month()) - 1
-	// log.DefaultLogger.Info("yearMonths:  start=%d, end=%d", startYearMonth, endYearMonth))
-
-	for yearmonth := endYearMonth; yearmonth >= startYearMonth; yearmonth-- {
-		iter := cass.createQuery(timeseriesTablename, tsQuery, org, query.Project, query.Subsystem, yearmonth, query.Datapoint, from, to)
-		scanner := iter.Scanner()
-		for scanner.Next() {
-			var rowValue model.TsPair
-			err := scanner.Scan(&rowValue.Value, &rowValue.TS)
-			if err != nil {
-				log.DefaultLogger.Error("Internal Error 1? Failed to read record", err)
+	count := endYearMonth - startYearMonth + 1
+	if count <= 0 {
+		return nil
+	}
+	partitions := make([][]model.TsPair, count)
+	errs := make([]error, count)
+	done := make([]chan struct{}, count)
+	jobs := make(chan int, count)
+	for i := 0; i < count; i++ {
+		done[i] = make(chan struct{})
+		jobs <- i
+	}
+	close(jobs)
+	for worker := 0; worker < min(partitionReaders, count); worker++ {
+		go func() {
+			for i := range jobs {
+				if errs[i] = ctx.Err(); errs[i] == nil {
+					partitions[i], errs[i] = cass.readPartition(ctx, org, query, startYearMonth+i, from, to)
+				}
+				close(done[i])
 			}
-			p := []model.TsPair{rowValue}
-			result = append(p, result...)
+		}()
+	}
+	for i := 0; i < count; i++ {
+		<-done[i]
+		if errs[i] != nil {
+			for range jobs {
+				// drain, so the workers stop after their current partition
+			}
+			return errs[i]
 		}
-		err := iter.Close()
+		consume(partitions[i])
+		partitions[i] = nil
+	}
+	return nil
+}
+
+// A month is treated as closed this long after it ended, since late samples still arrive just after the
+// month boundary.
+const partitionGracePeriod = 24 * time.Hour
+
+// Closed partitions are read again after this long, since samples can also be written into past months. This
+// is the only bound on how stale they are, since the writes are sent asynchronously through Pulsar and are not
+// in Cassandra when the write request returns.
+const partitionCacheTTL = time.Hour
+
+// readPartition reads the samples within the time range from a yearmonth partition, in chronological order.
+// Closed partitions, i.e. the months before the current one, are read in full and kept in the cache.
+func (cass *CassandraClient) readPartition(ctx context.Context, org int64, query model.QueryRef, yearmonth int, from time.Time, to time.Time) ([]model.TsPair, error) {
+	if yearmonth >= yearMonthOf(time.Now().Add(-partitionGracePeriod)) {
+		return cass.scanTimeseries(cass.createQueryWithContext(ctx, timeseriesTablename, tsQuery, org, query.Project, query.Subsystem, yearmonth, query.Datapoint, from, to))
+	}
+	partitionKey := partitionCacheKey(org, query.Project, query.Subsystem, query.Datapoint, yearmonth)
+	partition, found := cass.cache.getPartition(partitionKey)
+	if !found {
+		var err error
+		partition, err = cass.scanTimeseries(cass.createQueryWithContext(ctx, timeseriesTablename, tsPartitionQuery, org, query.Project, query.Subsystem, yearmonth, query.Datapoint))
 		if err != nil {
-			log.DefaultLogger.Error("Internal Error 2? Failed to read record", err)
-			return &result
+			return nil, err
 		}
+		cass.cache.put(partitionKey, partition, partitionCacheTTL)
 	}
-	slices.SortFunc(result, func(a, b model.TsPair) int {
-		if a.TS == b.TS {
-			return 0
+	rows := make([]model.TsPair, 0, len(partition))
+	for _, row := range partition {
+		if !row.TS.Before(from) && !row.TS.After(to) {
+			rows = append(rows, row)
 		}
-		if a.TS.Before(b.TS) {
-			return -1
+	}
+	return rows, nil
+}
+
+func yearMonthOf(tm time.Time) int {
+	utc := tm.UTC()
+	return utc.Year()*12 + int(utc.Month()) - 1
+}
+
+func partitionCacheKey(org int64, project string, subsystem string, datapoint string, yearmonth int) string {
+	return fmt.Sprintf("partition:%d/%s/%s/%s/%d", org, project, subsystem, datapoint, yearmonth)
+}
+
+func (cass *CassandraClient) scanTimeseries(iter *gocql.Iter) ([]model.TsPair, error) {
+	var rows []model.TsPair
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		var rowValue model.TsPair
+		err := scanner.Scan(&rowValue.Value, &rowValue.TS)
+		if err != nil {
+			log.DefaultLogger.Error("Internal Error 1? Failed to read record", err)
+			_ = iter.Close()
+			return nil, err
 		}
-		return 1
-	})
+		rows = append(rows, rowValue)
+	}
+	// The rows are normally stored in descending order within the partition.
+	compareTs := func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	}
+	if !slices.IsSortedFunc(rows, compareTs) {
+		slices.Reverse(rows)
+		if !slices.IsSortedFunc(rows, compareTs) {
+			slices.SortFunc(rows, compareTs)
+		}
+	}
+	return rows, iter.Close()
+}
+
+func (cass *CassandraClient) CacheStatistics() CacheStatistics {
+	return cass.cache.Statistics()
+}
 
-	return reduceSize(maxValues, &result, strings.TrimSpace(query.Aggregation), query.TimeModel, location)
+func resultCacheKey(org int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) string {
+	queryJson, _ := json.Marshal(query)
+	return fmt.Sprintf("%d:%s:%d:%d:%d", org, queryJson, from.UnixMilli(), to.UnixMilli(), maxValues)
 }
 
-func (cass *CassandraClient) QueryKeyValues(orgid int64, valuetype string, name string) (model.KeyValuesEntry, error) {
-	iter := cass.createQuery(keyvaluesTablename, keyvaluesQuery, orgid, valuetype, name)
+// QueryKeyValues returns the entry of the key, or an error wrapping model.ErrNotFound if there is none.
+func (cass *CassandraClient) QueryKeyValues(ctx context.Context, orgid int64, valuetype string, name string) (model.KeyValuesEntry, error) {
+	iter := cass.createQueryWithContext(ctx, keyvaluesTablename, keyvaluesQuery, orgid, valuetype, name)
 	scanner := iter.Scanner()
 	var keyValue model.KeyValuesEntry
-	scanner.Next()
+	if !scanner.Next() {
+		if err := iter.Close(); err != nil {
+			return keyValue, err
+		}
+		return keyValue, fmt.Errorf("%w: %s %s", model.ErrNotFound, valuetype, name)
+	}
 	err := scanner.Scan(&keyValue.OrgId, &keyValue.Type, &keyValue.Key, &keyValue.Value)
 	if err != nil {
 		log.DefaultLogger.Error("Internal Error 1? Failed to read record", err)
+		_ = iter.Close()
+		return keyValue, err
 	}
-	return keyValue, err
+	return keyValue, iter.Close()
 }
 
 func (cass *CassandraClient) QueryAllKeyValues(orgid int64, valuetype string) ([]model.KeyValuesEntry, error) {
@@ -132,15 +371,58 @@ func (cass *CassandraClient) QueryAllKeyValues(orgid int64, valuetype string) ([
 		err := scanner.Scan(&keyValue.OrgId, &keyValue.Type, &keyValue.Key, &keyValue.Value)
 		if err != nil {
 			log.DefaultLogger.Error("Internal Error 1? Failed to read record", err)
+			_ = iter.Close()
 			return keyValues, err
 		}
 		keyValues = append(keyValues, keyValue)
 	}
-	return keyValues, nil
+	return keyValues, iter.Close()
 }
 
-func (cass *CassandraClient) QueryAlarmStates(_ int64, _ model.QueryRef) ([]model.TsPair, error) {
-	return make([]model.TsPair, 0), nil
+// QueryAlarmStates returns the alarm state changes of query.AlarmProject, or of all the projects of the
+// organization, within the time range. They are limited to the Subsystem and Datapoint of the query if those
+// are given.
+func (cass *CassandraClient) QueryAlarmStates(ctx context.Context, org int64, query model.QueryRef, from time.Time, to time.Time) ([]model.AlarmState, error) {
+	log.DefaultLogger.With("org", org).With("project", query.AlarmProject).With("subsystem", query.Subsystem).With("datapoint", query.Datapoint).Info("queryAlarmStates()")
+	projects := []string{query.AlarmProject}
+	if query.AlarmProject == "" {
+		all, err := cass.FindAllProjects(ctx, org)
+		if err != nil {
+			return nil, err
+		}
+		projects = projects[:0]
+		for _, project := range all {
+			projects = append(projects, project.Name)
+		}
+	}
+	result := make([]model.AlarmState, 0)
+	for _, project := range projects {
+		iter := cass.createQueryWithContext(ctx, alarmStatesTablename, alarmStatesQuery, org, project, from, to)
+		scanner := iter.Scanner()
+		for scanner.Next() {
+			var rowValue model.AlarmState
+			err := scanner.Scan(&rowValue.TS, &rowValue.State, &rowValue.Severity, &rowValue.Project, &rowValue.Subsystem, &rowValue.Datapoint, &rowValue.Value, &rowValue.Message)
+			if err != nil {
+				log.DefaultLogger.With("error", err).Error("Unable to read Cassandra row(s)")
+				_ = iter.Close()
+				return nil, err
+			}
+			if query.Subsystem != "" && query.Subsystem != rowValue.Subsystem {
+				continue
+			}
+			if query.Datapoint != "" && query.Datapoint != rowValue.Datapoint {
+				continue
+			}
+			result = append(result, rowValue)
+		}
+		if err := iter.Close(); err != nil {
+			return nil, err
+		}
+	}
+	slices.SortFunc(result, func(a, b model.AlarmState) int {
+		return a.TS.Compare(b.TS)
+	})
+	return result, nil
 }
 
 func (cass *CassandraClient) GetCurrentLimits(orgId int64) (model.PlanLimits, error) {
@@ -176,9 +458,9 @@ func (cass *CassandraClient) GetOrganization(orgId int64) (model.OrganizationSet
 	return model.OrganizationSettings{}, iter.Close()
 }
 
-func (cass *CassandraClient) GetProject(orgId int64, name string) (model.ProjectSettings, error) {
+func (cass *CassandraClient) GetProject(ctx context.Context, orgId int64, name string) (model.ProjectSettings, error) {
 	log.DefaultLogger.Info("getProject:  " + strconv.FormatInt(orgId, 10) + "/" + name)
-	iter := cass.createQuery(projectsTablename, projectQuery, orgId, name)
+	iter := cass.createQueryWithContext(ctx, projectsTablename, projectQuery, orgId, name)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		var rowValue model.ProjectSettings
@@ -191,10 +473,10 @@ func (cass *CassandraClient) GetProject(orgId int64, name string) (model.Project
 	return model.ProjectSettings{}, iter.Close()
 }
 
-func (cass *CassandraClient) FindAllProjects(org int64) ([]model.ProjectSettings, error) {
+func (cass *CassandraClient) FindAllProjects(ctx context.Context, org int64) ([]model.ProjectSettings, error) {
 	log.DefaultLogger.Info("findAllProjects:  " + strconv.FormatInt(org, 10))
 	result := make([]model.ProjectSettings, 0)
-	iter := cass.createQuery(projectsTablename, projectsQuery, org)
+	iter := cass.createQueryWithContext(ctx, projectsTablename, projectsQuery, org)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		var rowValue model.ProjectSettings
@@ -260,10 +542,10 @@ func (cass *CassandraClient) GetSubsystem(org int64, projectName string, subsyst
 	return model.SubsystemSettings{}, iter.Close()
 }
 
-func (cass *CassandraClient) FindAllSubsystems(org int64, projectName string) ([]model.SubsystemSettings, error) {
+func (cass *CassandraClient) FindAllSubsystems(ctx context.Context, org int64, projectName string) ([]model.SubsystemSettings, error) {
 	log.DefaultLogger.Info("findAllSubsystems:  " + strconv.FormatInt(org, 10) + "/" + projectName)
 	result := make([]model.SubsystemSettings, 0)
-	iter := cass.createQuery(subsystemsTablename, subsystemsQuery, org, projectName)
+	iter := cass.createQueryWithContext(ctx, subsystemsTablename, subsystemsQuery, org, projectName)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		var rowValue model.SubsystemSettings
@@ -278,9 +560,9 @@ func (cass *CassandraClient) FindAllSubsystems(org int64, projectName string) ([
 	return result, iter.Close()
 }
 
-func (cass *CassandraClient) GetDatapoint(org int64, projectName string, subsystemName string, datapoint string) (model.DatapointSettings, error) {
+func (cass *CassandraClient) GetDatapoint(ctx context.Context, org int64, projectName string, subsystemName string, datapoint string) (model.DatapointSettings, error) {
 	log.DefaultLogger.Info("getDatapoint:  " + strconv.FormatInt(org, 10) + "/" + projectName + "/" + datapoint)
-	iter := cass.createQuery(datapointsTablename, datapointQuery, org, projectName, subsystemName, datapoint)
+	iter := cass.createQueryWithContext(ctx, datapointsTablename, datapointQuery, org, projectName, subsystemName, datapoint)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		return cass.deserializeDatapointRow(scanner), iter.Close()
@@ -288,10 +570,10 @@ func (cass *CassandraClient) GetDatapoint(org int64, projectName string, subsyst
 	return model.DatapointSettings{}, iter.Close()
 }
 
-func (cass *CassandraClient) FindAllDatapoints(org int64, projectName string, subsystemName string) ([]model.DatapointSettings, error) {
+func (cass *CassandraClient) FindAllDatapoints(ctx context.Context, org int64, projectName string, subsystemName string) ([]model.DatapointSettings, error) {
 	log.DefaultLogger.With("org", org).With("project", projectName).With("subsystem", subsystemName).Info("findAllDatapoints()")
 	result := make([]model.DatapointSettings, 0)
-	iter := cass.createQuery(datapointsTablename, datapointsQuery, org, projectName, subsystemName)
+	iter := cass.createQueryWithContext(ctx, datapointsTablename, datapointsQuery, org, projectName, subsystemName)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		datapoint := cass.deserializeDatapointRow(scanner)
@@ -323,7 +605,7 @@ func (cass *CassandraClient) SelectAllInJournal(org int64, journaltype string, j
 	return result, iter.Close()
 }
 
-func (cass *CassandraClient) SelectRangeInJournal(org int64, journaltype string, journalname string, from time.Time, to time.Time) (model.Journal, error) {
+func (cass *CassandraClient) SelectRangeInJournal(ctx context.Context, org int64, journaltype string, journalname string, from time.Time, to time.Time) (model.Journal, error) {
 	logger := log.DefaultLogger.With("org", org).With("journaltype", journaltype).With("journalname", journalname)
 
 	logger.Info("SelectAllInJournal()")
@@ -331,13 +613,14 @@ func (cass *CassandraClient) SelectRangeInJournal(org int64, journaltype string,
 		Type: journaltype,
 		Name: journalname,
 	}
-	iter := cass.createQuery(journalTablename, journalSelectRangeQuery, org, journaltype, journalname, from, to)
+	iter := cass.createQueryWithContext(ctx, journalTablename, journalSelectRangeQuery, org, journaltype, journalname, from, to)
 	scanner := iter.Scanner()
 	for scanner.Next() {
 		entry := model.JournalEntry{}
 		err := scanner.Scan(&entry.Value, &entry.Added)
 		if err != nil {
 			logger.With("error", err).Error("Unable to read Cassandra row(s)")
+			_ = iter.Close()
 			return model.Journal{}, err
 		}
 		result.Entries = append(result.Entries, entry)
@@ -345,6 +628,50 @@ func (cass *CassandraClient) SelectRangeInJournal(org int64, journaltype string,
 	return result, iter.Close()
 }
 
+// SelectPageInJournal returns at most limit entries within the time range, oldest first, so that the next page
+// starts just after the last entry.
+func (cass *CassandraClient) SelectPageInJournal(org int64, journaltype string, journalname string, from time.Time, to time.Time, limit int) (model.Journal, error) {
+	logger := log.DefaultLogger.With("org", org).With("journaltype", journaltype).With("journalname", journalname)
+
+	logger.Info("SelectPageInJournal()")
+	result := model.Journal{
+		Type:    journaltype,
+		Name:    journalname,
+		Entries: make([]model.JournalEntry, 0),
+	}
+	iter := cass.createQuery(journalTablename, journalSelectPageQuery, org, journaltype, journalname, from, to, limit)
+	scanner := iter.Scanner()
+	for scanner.Next() {
+		entry := model.JournalEntry{}
+		err := scanner.Scan(&entry.Value, &entry.Added)
+		if err != nil {
+			logger.With("error", err).Error("Unable to read Cassandra row(s)")
+			return model.Journal{}, err
+		}
+		result.Entries = append(result.Entries, entry)
+	}
+	return result, iter.Close()
+}
+
+// FindAllJournalNames returns the names of the journals of a type. Listing them from the journals table would
+// scan all of its partitions, so the names are kept in the keyvalues instead, with the type "journals/<type>"
+// and the name as key. They are recorded there when the addJournalEntry message is stored.
+func (cass *CassandraClient) FindAllJournalNames(org int64, journaltype string) ([]string, error) {
+	logger := log.DefaultLogger.With("org", org).With("journaltype", journaltype)
+
+	logger.Info("FindAllJournalNames()")
+	keyValues, err := cass.QueryAllKeyValues(org, journalNamesType+journaltype)
+	if err != nil {
+		logger.With("error", err).Error("Unable to read Cassandra row(s)")
+		return nil, err
+	}
+	result := make([]string, 0, len(keyValues))
+	for _, keyValue := range keyValues {
+		result = append(result, keyValue.Key)
+	}
+	return result, nil
+}
+
 func (cass *CassandraClient) Shutdown() {
 	log.DefaultLogger.Info("Shutdown Cassandra client")
 	cass.session.Close()
@@ -355,8 +682,14 @@ func (cass *CassandraClient) Err() error {
 }
 
 func (cass *CassandraClient) createQuery(tableName string, query string, args ...interface{}) *gocql.Iter {
+	return cass.createQueryWithContext(cass.ctx, tableName, query, args...)
+}
+
+// createQueryWithContext is for the queries that should be cancelled with the request, e.g. when Grafana
+// times out.
+func (cass *CassandraClient) createQueryWithContext(ctx context.Context, tableName string, query string, args ...interface{}) *gocql.Iter {
 	t := fmt.Sprintf(query, cass.clusterConfig.Keyspace, tableName)
-	q := cass.session.Query(t).Consistency(gocql.One).Idempotent(true).Bind(args...)
+	q := cass.session.Query(t).WithContext(ctx).Consistency(gocql.One).Idempotent(true).Bind(args...)
 	//	log.DefaultLogger.Info("query:  " + q.String())
 	return q.Iter()
 }
@@ -393,24 +726,75 @@ func (cass *CassandraClient) deserializeDatapointRow(scanner gocql.Scanner) mode
 	return r
 }
 
-func reduceSize(maxValues int, data *[]model.TsPair, aggregation string, timeModel string, location *time.Location) *[]model.TsPair {
+func reduceSize(maxValues int, data *[]model.TsPair, aggregation string, timeModel string, downsample string, location *time.Location) (*[]model.TsPair, error) {
 	if len(timeModel) > 0 {
 		log.DefaultLogger.Info(fmt.Sprintf("Reducing to %s", timeModel))
 	}
+	if err := checkAggregation(aggregation); err != nil {
+		return nil, err
+	}
+	if downsample != "" && aggregation != "" && aggregation != "sample" && timeModel == "" {
+		// The downsampling picks samples, so the aggregation would be silently ignored.
+		return nil, fmt.Errorf("%w: downsampling %s can't be combined with the aggregation %s without a time model", model.ErrBadRequest, downsample, aggregation)
+	}
+	if aggregation != "" && aggregation != "sample" && timeModel == "" && maxValues <= 0 {
+		// Without a time model, the aggregation only applies to the samples merged to stay within maxValues.
+		return nil, fmt.Errorf("%w: the aggregation %s needs a time model when all samples are requested", model.ErrBadRequest, aggregation)
+	}
+	if (aggregation == "" || aggregation == "sample") && maxValues <= 0 {
+		return inLocation(data, location), nil // no limit, all samples are returned
+	}
+	if aggregation == "" || aggregation == "sample" || timeModel == "" {
+		switch downsample {
+		case "lttb":
+			return reduceLttb(maxValues, data, location), nil
+		case "minmax":
+			return reduceMinMax(maxValues, data, location), nil
+		case "":
+		default:
+			return nil, fmt.Errorf("%w: unknown downsampling: %s", model.ErrBadRequest, downsample)
+		}
+	}
 	if aggregation == "" || aggregation == "sample" {
-		return reduceDefault(maxValues, data, "", location)
+		return reduceDefault(maxValues, data, "", location), nil
+	} else if timeModel == "" {
+		return reduceDefault(maxValues, data, aggregation, location), nil
 	} else {
-		switch timeModel {
-		case "daily":
-			return reduceInterval(data, daily, alignDay, aggregation, location)
-		case "weekly":
-			return reduceInterval(data, weekly, alignWeek, aggregation, location)
-		case "monthly":
-			return reduceInterval(data, monthly, alignMonth, aggregation, location)
-		default:
-			return reduceDefault(maxValues, data, aggregation, location)
+		inRange, align, err := timeModelFuncs(timeModel)
+		if err != nil {
+			return nil, err
 		}
+		return reduceInterval(data, inRange, align, aggregation, location), nil
+	}
+}
+
+// timeModelFuncs returns the inRange and align functions for reduceInterval() of the time model.
+func timeModelFuncs(timeModel string) (func(*model.TsPair, *time.Time, *time.Location) bool, func(*time.Time, *time.Location) time.Time, error) {
+	switch timeModel {
+	case "daily":
+		return daily, alignDay, nil
+	case "weekly":
+		return weekly, alignWeek, nil
+	case "monthly":
+		return monthly, alignMonth, nil
+	case "quarterhour":
+		return bucketChanged(alignQuarterHour), alignQuarterHour, nil
+	case "hourly":
+		return bucketChanged(alignHour), alignHour, nil
+	case "quarterly":
+		return bucketChanged(alignQuarter), alignQuarter, nil
+	case "yearly":
+		return bucketChanged(alignYear), alignYear, nil
+	}
+	// Arbitrary fixed durations, such as "10m" or "6h"
+	duration, err := time.ParseDuration(timeModel)
+	if err != nil || duration <= 0 {
+		return nil, nil, fmt.Errorf("%w: unknown time model: %s", model.ErrBadRequest, timeModel)
 	}
+	align := func(tm *time.Time, location *time.Location) time.Time {
+		return alignDuration(tm, location, duration)
+	}
+	return bucketChanged(align), align, nil
 }
 
 func reduceDefault(maxValues int, data *[]model.TsPair, aggregation string, location *time.Location) *[]model.TsPair {
@@ -433,35 +817,69 @@ func reduceDefault(maxValues int, data *[]model.TsPair, aggregation string, loca
 }
 
 func reduceInterval(data *[]model.TsPair, inRange func(*model.TsPair, *time.Time, *time.Location) bool, align func(*time.Time, *time.Location) time.Time, aggregation string, location *time.Location) *[]model.TsPair {
-	var result []model.TsPair
+	log.DefaultLogger.Info(fmt.Sprintf("Reducing %d datapoint to %s", len(*data), aggregation))
+	reducer := newIntervalReducer(inRange, align, aggregation, location)
+	reducer.add(*data)
+	return reducer.finish()
+}
 
-	dataLength := len(*data)
-	if dataLength == 0 {
-		return &result
+// intervalReducer aggregates the samples into time model buckets as they are added, so only the samples of
+// the current bucket are held in memory.
+type intervalReducer struct {
+	inRange     func(*model.TsPair, *time.Time, *time.Location) bool
+	align       func(*time.Time, *time.Location) time.Time
+	aggregation string
+	location    *time.Location
+	currentDate time.Time
+	bucket      []model.TsPair // the last sample of the previous bucket, if any, followed by the current bucket
+	started     bool
+	result      []model.TsPair
+}
+
+func newIntervalReducer(inRange func(*model.TsPair, *time.Time, *time.Location) bool, align func(*time.Time, *time.Location) time.Time, aggregation string, location *time.Location) *intervalReducer {
+	return &intervalReducer{
+		inRange:     inRange,
+		align:       align,
+		aggregation: aggregation,
+		location:    location,
 	}
-	log.DefaultLogger.Info(fmt.Sprintf("Reducing %d datapoint to %s", dataLength, aggregation))
-	var end int
-	localTimeFirst := (*data)[0].TS.In(location)
-	currentDate := align(&localTimeFirst, location)
-	start := 0
-	for index := 0; index < len(*data); index++ {
-		tsPair := (*data)[index]
-		if inRange(&tsPair, &currentDate, location) {
-			aggregated, err := aggregated(aggregation, data, start, end)
-			if err == nil {
-				result = append(result, model.TsPair{TS: currentDate, Value: aggregated})
-			}
-			start = index
-			currentDate = align(&tsPair.TS, location)
+}
+
+func (r *intervalReducer) add(data []model.TsPair) {
+	for index := range data {
+		tsPair := data[index]
+		if len(r.bucket) == 0 {
+			localTimeFirst := tsPair.TS.In(r.location)
+			r.currentDate = r.align(&localTimeFirst, r.location)
+		} else if r.inRange(&tsPair, &r.currentDate, r.location) {
+			r.flush()
+			previous := r.bucket[len(r.bucket)-1]
+			r.bucket = append(r.bucket[:0], previous)
+			r.started = true
+			r.currentDate = r.align(&tsPair.TS, r.location)
 		}
-		end = index
+		r.bucket = append(r.bucket, tsPair)
 	}
-	// Add the last time period too, even though incomplete.
-	aggregated, err := aggregated(aggregation, data, start, end)
+}
+
+func (r *intervalReducer) flush() {
+	// deltaOf() looks at the sample before start, which is the last sample of the previous bucket.
+	start := 0
+	if r.started {
+		start = 1
+	}
+	aggregated, err := aggregated(r.aggregation, &r.bucket, start, len(r.bucket)-1)
 	if err == nil {
-		result = append(result, model.TsPair{TS: currentDate, Value: aggregated})
+		r.result = append(r.result, model.TsPair{TS: r.currentDate, Value: aggregated})
 	}
-	return &result
+}
+
+// finish adds the last time period too, even though incomplete.
+func (r *intervalReducer) finish() *[]model.TsPair {
+	if len(r.bucket) > 0 {
+		r.flush()
+	}
+	return &r.result
 }
 
 func alignDay(tm *time.Time, location *time.Location) time.Time {
@@ -486,6 +904,50 @@ func alignMonth(tm *time.Time, location *time.Location) time.Time {
 	return aligned
 }
 
+func alignQuarter(tm *time.Time, location *time.Location) time.Time {
+	localTime := tm.In(location)
+	year, month, _ := localTime.Date()
+	firstMonth := month - (month-1)%3
+	return time.Date(year, firstMonth, 1, 0, 0, 0, 0, location)
+}
+
+func alignYear(tm *time.Time, location *time.Location) time.Time {
+	localTime := tm.In(location)
+	return time.Date(localTime.Year(), time.January, 1, 0, 0, 0, 0, location)
+}
+
+func alignQuarterHour(tm *time.Time, location *time.Location) time.Time {
+	return alignDuration(tm, location, 15*time.Minute)
+}
+
+func alignHour(tm *time.Time, location *time.Location) time.Time {
+	return alignDuration(tm, location, time.Hour)
+}
+
+// AlignDuration is alignDuration for the grids that the series are sampled on outside of this package.
+func AlignDuration(tm time.Time, location *time.Location, duration time.Duration) time.Time {
+	return alignDuration(&tm, location, duration)
+}
+
+// alignDuration truncates to the local wall clock, so that e.g. 6h buckets start at 00, 06, 12 and 18 local
+// time, also for timezones with non-whole hour offsets. The offset of the sample is kept when possible, so
+// that the two hours with the same wall clock during the DST fall back ends up in separate buckets.
+func alignDuration(tm *time.Time, location *time.Location, duration time.Duration) time.Time {
+	localTime := tm.In(location)
+	_, offset := localTime.Zone()
+	year, month, day := localTime.Date()
+	hour, minute, second := localTime.Clock()
+	wallClock := time.Date(year, month, day, hour, minute, second, localTime.Nanosecond(), time.UTC).Truncate(duration)
+	aligned := wallClock.Add(-time.Duration(offset) * time.Second).In(location)
+	if _, alignedOffset := aligned.Zone(); alignedOffset != offset {
+		// The bucket starts on the other side of a DST transition.
+		year, month, day = wallClock.Date()
+		hour, minute, second = wallClock.Clock()
+		aligned = time.Date(year, month, day, hour, minute, second, 0, location)
+	}
+	return aligned
+}
+
 func alignSample(tm *time.Time, location *time.Location) time.Time {
 	localTime := tm.In(location)
 	year, month, day := localTime.Date()
@@ -511,7 +973,14 @@ func monthly(tsPair *model.TsPair, currentDate *time.Time, location *time.Locati
 	return change
 }
 
-func createLocation(timezone string) *time.Location {
+// bucketChanged creates an inRange function for reduceInterval(), from the align function of a time model.
+func bucketChanged(align func(*time.Time, *time.Location) time.Time) func(*model.TsPair, *time.Time, *time.Location) bool {
+	return func(tsPair *model.TsPair, currentDate *time.Time, location *time.Location) bool {
+		return !align(&tsPair.TS, location).Equal(*currentDate)
+	}
+}
+
+func CreateLocation(timezone string) *time.Location {
 	loc, err := time.LoadLocation(timezone)
 	if err != nil {
 		log.DefaultLogger.With("timezone", timezone).Error("Timezone does not exist")
@@ -525,22 +994,76 @@ func aggregated(aggregation string, data *[]model.TsPair, start int, end int) (f
 	switch aggregation {
 	case "":
 		value = lastSampleOf(data, start, end) // takes the last sample
+	case "first":
+		value = firstSampleOf(data, start, end) // takes the first sample
 	case "delta":
 		value = deltaOf(data, start, end) // calcs the difference between last sample and previous last sample
 	case "min":
 		value = minimumOf(data, start, end) // minimum value within the range of values to be aggregated
 	case "max":
 		value = maximumOf(data, start, end) // maximum valuee within the range of values to be aggregated
+	case "range":
+		value = maximumOf(data, start, end) - minimumOf(data, start, end) // the spread between max and min
 	case "sum":
 		value = sumOf(data, start, end) // sum of all values within the range of values to be aggregated
 	case "average":
 		value = averageOf(data, start, end) // average of the values being aggregated
+	case "median":
+		value = percentileOf(data, start, end, 50.0)
+	case "stddev":
+		value = math.Sqrt(varianceOf(data, start, end)) // sample standard deviation
+	case "variance":
+		value = varianceOf(data, start, end) // sample variance
+	case "count":
+		value = float64(1 + end - start) // number of samples being aggregated
+	case "integral":
+		value = integralOf(data, start, end) // the area under the curve, in value-hours, e.g. kW -> kWh
 	default:
-		value = 0.0
+		percentile, ok := parsePercentile(aggregation)
+		if !ok {
+			return 0.0, fmt.Errorf("%w: unknown aggregation: %s", model.ErrBadRequest, aggregation)
+		}
+		value = percentileOf(data, start, end, percentile) // pNN, e.g. p5, p95 or p99.9
 	}
 	return value, nil
 }
 
+// Aggregate reduces the whole series to a single value with any of the aggregations of the time models, e.g.
+// for ranking the series. The value is NaN if there are no samples. The series must be in chronological order.
+func Aggregate(aggregation string, data *[]model.TsPair) (float64, error) {
+	if aggregation == "sample" {
+		aggregation = ""
+	}
+	if len(*data) == 0 {
+		if err := checkAggregation(aggregation); err != nil {
+			return math.NaN(), err
+		}
+		return math.NaN(), nil
+	}
+	return aggregated(aggregation, data, 0, len(*data)-1)
+}
+
+// checkAggregation validates the aggregation name before any data is reduced.
+func checkAggregation(aggregation string) error {
+	if aggregation == "sample" {
+		return nil
+	}
+	single := []model.TsPair{{}}
+	_, err := aggregated(aggregation, &single, 0, 0)
+	return err
+}
+
+func parsePercentile(aggregation string) (float64, bool) {
+	if !strings.HasPrefix(aggregation, "p") {
+		return 0, false
+	}
+	percentile, err := strconv.ParseFloat(aggregation[1:], 64)
+	if err != nil || math.IsNaN(percentile) || percentile < 0 || percentile > 100 {
+		return 0, false
+	}
+	return percentile, true
+}
+
 func sumOf(data *[]model.TsPair, start int, end int) float64 {
 	sum := (*data)[start].Value
 	for i := start + 1; i <= end; i++ {
@@ -584,6 +1107,47 @@ func lastSampleOf(data *[]model.TsPair, _ int, end int) float64 {
 	return (*data)[end].Value
 }
 
+func firstSampleOf(data *[]model.TsPair, start int, _ int) float64 {
+	return (*data)[start].Value
+}
+
+func varianceOf(data *[]model.TsPair, start int, end int) float64 {
+	count := 1 + end - start
+	if count < 2 {
+		return 0.0
+	}
+	mean := averageOf(data, start, end)
+	sumOfSquares := 0.0
+	for i := start; i <= end; i++ {
+		diff := (*data)[i].Value - mean
+		sumOfSquares = sumOfSquares + diff*diff
+	}
+	return sumOfSquares / float64(count-1)
+}
+
+// percentileOf interpolates linearly between the closest ranks.
+func percentileOf(data *[]model.TsPair, start int, end int, percentile float64) float64 {
+	values := make([]float64, 0, 1+end-start)
+	for i := start; i <= end; i++ {
+		values = append(values, (*data)[i].Value)
+	}
+	slices.Sort(values)
+	rank := percentile / 100.0 * float64(len(values)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return values[lower] + (values[upper]-values[lower])*(rank-float64(lower))
+}
+
+// integralOf uses the trapezoidal rule, with the time measured in hours.
+func integralOf(data *[]model.TsPair, start int, end int) float64 {
+	integral := 0.0
+	for i := start + 1; i <= end; i++ {
+		hours := (*data)[i].TS.Sub((*data)[i-1].TS).Hours()
+		integral = integral + hours*((*data)[i].Value+(*data)[i-1].Value)/2
+	}
+	return integral
+}
+
 const projectsTablename = "projects"
 
 const projectQuery = "SELECT name,title,city,country,timezone,geolocation FROM %s.%s WHERE orgid = ? AND name = ? AND DELETED = '1970-01-01 0:00:00+0000' ALLOW FILTERING;"
@@ -635,6 +1199,19 @@ const tsQuery = "SELECT value,ts FROM %s.%s" +
 	" ts <= ?" +
 	";"
 
+const tsPartitionQuery = "SELECT value,ts FROM %s.%s" +
+	" WHERE" +
+	" orgId = ?" +
+	" AND" +
+	" project = ?" +
+	" AND" +
+	" subsystem = ?" +
+	" AND" +
+	" yearmonth = ?" +
+	" AND" +
+	" datapoint = ?" +
+	";"
+
 const (
 	keyValuesTablename   = "keyvalues"
 	keyValuesSelectQuery = `SELECT type, key, created, value FROM %s.%s 
@@ -644,8 +1221,23 @@ const (
 		ALLOW FILTERING;`
 )
 
+// The alarm states are not in the schema of this repository. They are written by the alarm service, one row
+// per state change, to a table partitioned per project, so that a time range is read from one partition;
+//
+//	CREATE TABLE alarmstates (
+//	    orgid bigint, project text, ts timestamp, subsystem text, datapoint text,
+//	    state text, severity text, value double, message text,
+//	    PRIMARY KEY ((orgid, project), ts, subsystem, datapoint)
+//	);
+const (
+	alarmStatesTablename = "alarmstates"
+	alarmStatesQuery     = "SELECT ts,state,severity,project,subsystem,datapoint,value,message FROM %s.%s WHERE orgid = ? AND project = ? AND ts >= ? AND ts <= ?;"
+)
+
 const (
 	journalTablename        = "journals"
 	journalSelectAllQuery   = "SELECT value,ts FROM %s.%s WHERE orgid = ? AND type = ? AND name = ?;"
 	journalSelectRangeQuery = "SELECT value,ts FROM %s.%s WHERE orgid = ? AND type = ? AND name = ? AND ts >= ? AND  ts <= ? ;"
+	journalSelectPageQuery  = "SELECT value,ts FROM %s.%s WHERE orgid = ? AND type = ? AND name = ? AND ts >= ? AND  ts <= ? ORDER BY ts ASC LIMIT ?;"
+	journalNamesType        = "journals/"
 )
@@ -0,0 +1,95 @@
+package client
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func TestParsePercentile(t *testing.T) {
+	valid := map[string]float64{"p0": 0, "p5": 5, "p95": 95, "p99.9": 99.9, "p100": 100}
+	for aggregation, expected := range valid {
+		percentile, ok := parsePercentile(aggregation)
+		if !ok || percentile != expected {
+			t.Errorf("parsePercentile(%q) = %v, %v; expected %v, true", aggregation, percentile, ok, expected)
+		}
+	}
+	for _, aggregation := range []string{"p", "pNaN", "pnan", "p-1", "p100.1", "pInf", "p+Inf", "x50", "p5x"} {
+		if _, ok := parsePercentile(aggregation); ok {
+			t.Errorf("parsePercentile(%q) should be rejected", aggregation)
+		}
+	}
+}
+
+func TestCheckAggregationRejectsNaNPercentile(t *testing.T) {
+	if err := checkAggregation("pNaN"); err == nil {
+		t.Fatal("checkAggregation(\"pNaN\") should fail")
+	}
+}
+
+func TestPercentileOf(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := make([]model.TsPair, 0, 5)
+	for i, value := range []float64{5, 1, 4, 2, 3} {
+		data = append(data, model.TsPair{TS: start.Add(time.Duration(i) * time.Minute), Value: value})
+	}
+	cases := map[float64]float64{0: 1, 50: 3, 100: 5, 25: 2, 90: 4.6}
+	for percentile, expected := range cases {
+		if value := percentileOf(&data, 0, len(data)-1, percentile); value != expected {
+			t.Errorf("percentileOf(%v) = %v; expected %v", percentile, value, expected)
+		}
+	}
+}
+
+func TestReduceSizeRejectsDownsamplingWithAggregation(t *testing.T) {
+	data := []model.TsPair{{TS: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Value: 1}}
+	for _, downsample := range []string{"lttb", "minmax"} {
+		if _, err := reduceSize(10, &data, "average", "", downsample, time.UTC); err == nil {
+			t.Errorf("reduceSize() with %s and an aggregation should fail", downsample)
+		}
+		if _, err := reduceSize(10, &data, "average", "daily", downsample, time.UTC); err != nil {
+			t.Errorf("reduceSize() with %s and a time model: %v", downsample, err)
+		}
+	}
+}
+
+func TestCutToRange(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := seriesOf(start, 10*time.Minute, 0, 1, 2, 3, 4)
+	from, to := start.Add(15*time.Minute), start.Add(30*time.Minute)
+	if cut := *cutToRange(data, from, to, false); len(cut) != 2 || cut[0].Value != 2 || cut[1].Value != 3 {
+		t.Errorf("cutToRange() = %v; expected the samples at 20 and 30 minutes", cut)
+	}
+	// The bucket that from falls in is kept, also when the buckets are newest first.
+	slices.Reverse(data)
+	if cut := *cutToRange(data, from, to, true); len(cut) != 3 || cut[0].Value != 3 || cut[2].Value != 1 {
+		t.Errorf("cutToRange() = %v; expected the buckets at 30, 20 and 10 minutes", cut)
+	}
+}
+
+func TestReduceSizeRejectsAggregationWithoutTimeModel(t *testing.T) {
+	data := []model.TsPair{{TS: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Value: 1}}
+	if _, err := reduceSize(0, &data, "average", "", "", time.UTC); !errors.Is(err, model.ErrBadRequest) {
+		t.Errorf("reduceSize() of all samples with an aggregation and no time model = %v; expected a bad request", err)
+	}
+	if _, err := reduceSize(0, &data, "sample", "", "", time.UTC); err != nil {
+		t.Errorf("reduceSize() of all samples: %v", err)
+	}
+}
+
+func TestParseTimeShift(t *testing.T) {
+	valid := map[string]int{"1w": 1, "30d": 30, "12M": 12, "90m": 90}
+	for shift, expected := range valid {
+		if amount, _, err := parseTimeShift(shift); err != nil || amount != expected {
+			t.Errorf("parseTimeShift(%q) = %v, %v; expected %v", shift, amount, err, expected)
+		}
+	}
+	for _, shift := range []string{"", "w", "0d", "-1w", "+-1d", "1x", "1.5h"} {
+		if _, _, err := parseTimeShift(shift); !errors.Is(err, model.ErrBadRequest) {
+			t.Errorf("parseTimeShift(%q) = %v; expected a bad request", shift, err)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// Base temperature of the degree days, when not given in the query.
+const defaultBaseTemperature = 18.0
+
+// degreeDaysOf computes the heating ("hdd") or cooling ("cdd") degree days of a temperature series, from the
+// average temperature of each day in the timezone of the project. The first and the last day count for the
+// part of the day within the time range only. The degree days are then summed per week or month, if that is
+// the time model.
+func degreeDaysOf(data *[]model.TsPair, aggregation string, baseTemperature *float64, timeModel string, from time.Time, to time.Time, location *time.Location) (*[]model.TsPair, error) {
+	base := defaultBaseTemperature
+	if baseTemperature != nil {
+		base = *baseTemperature
+	}
+	dailyMeans := reduceInterval(data, daily, alignDay, "average", location)
+	degreeDays := make([]model.TsPair, 0, len(*dailyMeans))
+	for _, day := range *dailyMeans {
+		var value float64
+		if aggregation == "hdd" {
+			value = math.Max(base-day.Value, 0)
+		} else {
+			value = math.Max(day.Value-base, 0)
+		}
+		value = value * dayCoveredBy(day.TS, from, to)
+		degreeDays = append(degreeDays, model.TsPair{TS: day.TS, Value: value})
+	}
+	switch timeModel {
+	case "", "daily":
+		return &degreeDays, nil
+	case "weekly", "monthly", "quarterly", "yearly":
+		inRange, align, err := timeModelFuncs(timeModel)
+		if err != nil {
+			return nil, err
+		}
+		return reduceInterval(&degreeDays, inRange, align, "sum", location), nil
+	}
+	return nil, fmt.Errorf("%w: degree days are per day, week, month, quarter or year, not %s", model.ErrBadRequest, timeModel)
+}
+
+// dayCoveredBy returns the fraction of the day starting at start that is within the time range.
+func dayCoveredBy(start time.Time, from time.Time, to time.Time) float64 {
+	end := start.AddDate(0, 0, 1)
+	coveredFrom, coveredTo := start, end
+	if from.After(coveredFrom) {
+		coveredFrom = from
+	}
+	if to.Before(coveredTo) {
+		coveredTo = to
+	}
+	if !coveredTo.After(coveredFrom) {
+		return 0
+	}
+	return float64(coveredTo.Sub(coveredFrom)) / float64(end.Sub(start))
+}
+
+func isDegreeDays(aggregation string) bool {
+	return aggregation == "hdd" || aggregation == "cdd"
+}
@@ -0,0 +1,40 @@
+package client
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestDegreeDaysPartialDays(t *testing.T) {
+	from := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 1, 3, 6, 0, 0, 0, time.UTC)
+	values := make([]float64, 0, 42)
+	for ts := from; !ts.After(to); ts = ts.Add(time.Hour) {
+		values = append(values, 8)
+	}
+	data := seriesOf(from, time.Hour, values...)
+	degreeDays, err := degreeDaysOf(&data, "hdd", nil, "", from, to, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Half of the first day and a quarter of the last are within the time range.
+	expected := []float64{5, 10, 2.5}
+	if len(*degreeDays) != len(expected) {
+		t.Fatalf("degreeDaysOf() = %v; expected %v", *degreeDays, expected)
+	}
+	for i, day := range *degreeDays {
+		if math.Abs(day.Value-expected[i]) > 1e-9 {
+			t.Errorf("day %d has %v degree days; expected %v", i, day.Value, expected[i])
+		}
+	}
+
+	base := 5.0
+	cooling, err := degreeDaysOf(&data, "cdd", &base, "monthly", from, to, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*cooling) != 1 || math.Abs((*cooling)[0].Value-5.25) > 1e-9 {
+		t.Errorf("degreeDaysOf() = %v; expected 5.25 cooling degree days in January", *cooling)
+	}
+}
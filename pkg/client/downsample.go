@@ -0,0 +1,110 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// reduceLttb downsamples with the Largest-Triangle-Three-Buckets algorithm, which keeps the original
+// samples that contribute the most to the visual shape of the series, such as short spikes.
+func reduceLttb(maxValues int, data *[]model.TsPair, location *time.Location) *[]model.TsPair {
+	dataLength := len(*data)
+	if maxValues < 3 || dataLength <= maxValues {
+		return inLocation(data, location)
+	}
+	log.DefaultLogger.Info(fmt.Sprintf("LTTB reducing datapoints from %d to %d", dataLength, maxValues))
+	downsized := make([]model.TsPair, 0, maxValues)
+	downsized = append(downsized, (*data)[0])
+
+	// First and last samples are always kept, the rest are divided into maxValues-2 buckets.
+	bucketSize := float64(dataLength-2) / float64(maxValues-2)
+	selected := 0
+	for bucket := 0; bucket < maxValues-2; bucket++ {
+		start := int(float64(bucket)*bucketSize) + 1
+		end := int(float64(bucket+1)*bucketSize) + 1
+
+		// The third point of the triangle is the average of the next bucket.
+		nextStart := end
+		nextEnd := int(float64(bucket+2)*bucketSize) + 1
+		if nextEnd > dataLength {
+			nextEnd = dataLength
+		}
+		avgX, avgY := 0.0, 0.0
+		for i := nextStart; i < nextEnd; i++ {
+			avgX = avgX + secondsOf(&(*data)[i])
+			avgY = avgY + (*data)[i].Value
+		}
+		count := float64(nextEnd - nextStart)
+		avgX = avgX / count
+		avgY = avgY / count
+
+		selectedX := secondsOf(&(*data)[selected])
+		selectedY := (*data)[selected].Value
+		maxArea := -1.0
+		next := start
+		for i := start; i < end; i++ {
+			area := math.Abs((selectedX-avgX)*((*data)[i].Value-selectedY) - (selectedX-secondsOf(&(*data)[i]))*(avgY-selectedY))
+			if area > maxArea {
+				maxArea = area
+				next = i
+			}
+		}
+		downsized = append(downsized, (*data)[next])
+		selected = next
+	}
+	downsized = append(downsized, (*data)[dataLength-1])
+	return inLocation(&downsized, location)
+}
+
+// reduceMinMax keeps the minimum and the maximum sample of each bucket, in the order they occurred, so
+// that the envelope of the series is preserved.
+func reduceMinMax(maxValues int, data *[]model.TsPair, location *time.Location) *[]model.TsPair {
+	dataLength := len(*data)
+	buckets := maxValues / 2
+	if buckets < 1 || dataLength <= maxValues {
+		return inLocation(data, location)
+	}
+	log.DefaultLogger.Info(fmt.Sprintf("Min/max reducing datapoints from %d to %d", dataLength, maxValues))
+	downsized := make([]model.TsPair, 0, 2*buckets)
+	bucketSize := (dataLength + buckets - 1) / buckets
+	for start := 0; start < dataLength; start = start + bucketSize {
+		end := start + bucketSize
+		if end > dataLength {
+			end = dataLength
+		}
+		minIndex, maxIndex := start, start
+		for i := start + 1; i < end; i++ {
+			if (*data)[i].Value < (*data)[minIndex].Value {
+				minIndex = i
+			}
+			if (*data)[i].Value > (*data)[maxIndex].Value {
+				maxIndex = i
+			}
+		}
+		first, second := minIndex, maxIndex
+		if first > second {
+			first, second = second, first
+		}
+		downsized = append(downsized, (*data)[first])
+		if second != first {
+			downsized = append(downsized, (*data)[second])
+		}
+	}
+	return inLocation(&downsized, location)
+}
+
+func secondsOf(tsPair *model.TsPair) float64 {
+	return float64(tsPair.TS.UnixMilli()) / 1000.0
+}
+
+func inLocation(data *[]model.TsPair, location *time.Location) *[]model.TsPair {
+	result := make([]model.TsPair, len(*data))
+	for i, tsPair := range *data {
+		result[i] = model.TsPair{TS: tsPair.TS.In(location), Value: tsPair.Value}
+	}
+	return &result
+}
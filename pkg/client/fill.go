@@ -0,0 +1,138 @@
+package client
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// fillGaps inserts samples where the series has gaps, according to the fill policy;
+//
+//	"null"     - NaN values, which are returned as nulls to Grafana so that lines are broken
+//	"previous" - the value before the gap
+//	"linear"   - linear interpolation between the values on each side of the gap
+//	"zero"     - zero values
+//
+// With a time model, every missing bucket is filled. Otherwise, a gap is anything longer than one and
+// a half of the expected step, which is the poll interval or the spacing of the reduced series.
+func fillGaps(data *[]model.TsPair, fill string, timeModel string, pollInterval time.Duration, location *time.Location) (*[]model.TsPair, error) {
+	if fill != "null" && fill != "previous" && fill != "linear" && fill != "zero" {
+		return nil, fmt.Errorf("%w: unknown fill policy: %s", model.ErrBadRequest, fill)
+	}
+	if len(*data) < 2 {
+		return data, nil
+	}
+	sorted := slices.Clone(*data)
+	slices.SortFunc(sorted, func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	})
+
+	next, err := nextBucketFunc(timeModel)
+	if err != nil {
+		return nil, err
+	}
+	if next == nil {
+		step := max(pollInterval, MedianSpacing(sorted))
+		if step <= 0 {
+			return &sorted, nil
+		}
+		next = func(tm time.Time, _ *time.Location) time.Time {
+			return tm.Add(step)
+		}
+	}
+
+	result := make([]model.TsPair, 0, len(sorted))
+	result = append(result, sorted[0])
+	for i := 1; i < len(sorted); i++ {
+		previous := sorted[i-1]
+		current := sorted[i]
+		// Each step is checked against the one before it, since the jitter is allowed on a single step.
+		for last, ts := previous.TS, next(previous.TS, location); isGap(last, ts, current.TS, timeModel); last, ts = ts, next(ts, location) {
+			result = append(result, model.TsPair{TS: ts, Value: fillValue(fill, &previous, &current, ts)})
+			if fill == "null" && timeModel == "" {
+				break // one null is enough to break the line
+			}
+		}
+		result = append(result, current)
+	}
+	return &result, nil
+}
+
+func isGap(previous time.Time, expected time.Time, current time.Time, timeModel string) bool {
+	if timeModel != "" {
+		return expected.Before(current)
+	}
+	// Allow some jitter in the polling, before treating it as a gap.
+	halfStep := expected.Sub(previous) / 2
+	return expected.Add(halfStep).Before(current)
+}
+
+func fillValue(fill string, previous *model.TsPair, current *model.TsPair, ts time.Time) float64 {
+	switch fill {
+	case "previous":
+		return previous.Value
+	case "linear":
+		fraction := float64(ts.Sub(previous.TS)) / float64(current.TS.Sub(previous.TS))
+		return previous.Value + fraction*(current.Value-previous.Value)
+	case "zero":
+		return 0.0
+	}
+	return math.NaN()
+}
+
+// nextBucketFunc returns a function for finding the start of the bucket after the given one, for the time
+// model. For fixed durations, the next bucket is searched one and a half duration ahead and aligned, to
+// stay on the wall clock across DST transitions. Returns nil if there is no time model.
+func nextBucketFunc(timeModel string) (func(time.Time, *time.Location) time.Time, error) {
+	calendar := func(years int, months int, days int) func(time.Time, *time.Location) time.Time {
+		return func(tm time.Time, location *time.Location) time.Time {
+			return tm.In(location).AddDate(years, months, days)
+		}
+	}
+	fixed := func(duration time.Duration) func(time.Time, *time.Location) time.Time {
+		return func(tm time.Time, location *time.Location) time.Time {
+			ahead := tm.Add(duration * 3 / 2)
+			return alignDuration(&ahead, location, duration)
+		}
+	}
+	switch timeModel {
+	case "":
+		return nil, nil
+	case "daily":
+		return calendar(0, 0, 1), nil
+	case "weekly":
+		return calendar(0, 0, 7), nil
+	case "monthly":
+		return calendar(0, 1, 0), nil
+	case "quarterly":
+		return calendar(0, 3, 0), nil
+	case "yearly":
+		return calendar(1, 0, 0), nil
+	case "quarterhour":
+		return fixed(15 * time.Minute), nil
+	case "hourly":
+		return fixed(time.Hour), nil
+	}
+	duration, err := time.ParseDuration(timeModel)
+	if err != nil || duration <= 0 {
+		return nil, fmt.Errorf("%w: unknown time model: %s", model.ErrBadRequest, timeModel)
+	}
+	return fixed(duration), nil
+}
+
+// MedianSpacing returns the typical time between the samples of a series in chronological order, and 0 if
+// there are less than two samples.
+func MedianSpacing(data []model.TsPair) time.Duration {
+	if len(data) < 2 {
+		return 0
+	}
+	spacings := make([]time.Duration, 0, len(data)-1)
+	for i := 1; i < len(data); i++ {
+		spacings = append(spacings, data[i].TS.Sub(data[i-1].TS))
+	}
+	slices.Sort(spacings)
+	return spacings[len(spacings)/2]
+}
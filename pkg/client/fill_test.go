@@ -0,0 +1,118 @@
+package client
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func seriesOf(start time.Time, step time.Duration, values ...float64) []model.TsPair {
+	data := make([]model.TsPair, 0, len(values))
+	for i, value := range values {
+		data = append(data, model.TsPair{TS: start.Add(time.Duration(i) * step), Value: value})
+	}
+	return data
+}
+
+func TestMedianSpacing(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if spacing := MedianSpacing(nil); spacing != 0 {
+		t.Errorf("MedianSpacing(nil) = %v; expected 0", spacing)
+	}
+	if spacing := MedianSpacing(seriesOf(start, time.Minute, 1)); spacing != 0 {
+		t.Errorf("MedianSpacing() of one sample = %v; expected 0", spacing)
+	}
+	data := seriesOf(start, time.Minute, 1, 2, 3, 4)
+	data = append(data, model.TsPair{TS: start.Add(time.Hour), Value: 5})
+	if spacing := MedianSpacing(data); spacing != time.Minute {
+		t.Errorf("MedianSpacing() = %v; expected %v", spacing, time.Minute)
+	}
+}
+
+func TestFillGaps(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// 10 minute samples, with the samples at 30 and 40 minutes missing.
+	data := seriesOf(start, 10*time.Minute, 0, 1, 2)
+	data = append(data, model.TsPair{TS: start.Add(50 * time.Minute), Value: 5})
+
+	cases := map[string][]float64{
+		"previous": {0, 1, 2, 2, 2, 5},
+		"linear":   {0, 1, 2, 3, 4, 5},
+		"zero":     {0, 1, 2, 0, 0, 5},
+	}
+	for fill, expected := range cases {
+		filled, err := fillGaps(&data, fill, "", 10*time.Minute, time.UTC)
+		if err != nil {
+			t.Fatalf("fillGaps(%s): %v", fill, err)
+		}
+		if len(*filled) != len(expected) {
+			t.Fatalf("fillGaps(%s) returned %d samples; expected %d", fill, len(*filled), len(expected))
+		}
+		for i, tsPair := range *filled {
+			if !tsPair.TS.Equal(start.Add(time.Duration(i) * 10 * time.Minute)) {
+				t.Errorf("fillGaps(%s)[%d] at %v", fill, i, tsPair.TS)
+			}
+			if math.Abs(tsPair.Value-expected[i]) > 1e-9 {
+				t.Errorf("fillGaps(%s)[%d] = %v; expected %v", fill, i, tsPair.Value, expected[i])
+			}
+		}
+	}
+
+	// A single null is enough to break the line.
+	filled, err := fillGaps(&data, "null", "", 10*time.Minute, time.UTC)
+	if err != nil {
+		t.Fatalf("fillGaps(null): %v", err)
+	}
+	if len(*filled) != 5 || !math.IsNaN((*filled)[3].Value) {
+		t.Errorf("fillGaps(null) = %v; expected one NaN after the third sample", *filled)
+	}
+}
+
+func TestFillGapsJitter(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := []model.TsPair{
+		{TS: start, Value: 1},
+		{TS: start.Add(10 * time.Minute), Value: 2},
+		{TS: start.Add(24 * time.Minute), Value: 3}, // less than one and a half poll interval late
+	}
+	filled, err := fillGaps(&data, "zero", "", 10*time.Minute, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*filled) != len(data) {
+		t.Errorf("fillGaps() = %v; expected no filled samples", *filled)
+	}
+}
+
+func TestFillGapsTimeModel(t *testing.T) {
+	location, err := time.LoadLocation("Europe/Stockholm")
+	if err != nil {
+		t.Skip("no timezone database")
+	}
+	// Daily buckets across the DST change on 29 March 2026, with the 28th and 29th missing.
+	data := []model.TsPair{
+		{TS: time.Date(2026, 3, 27, 0, 0, 0, 0, location), Value: 1},
+		{TS: time.Date(2026, 3, 30, 0, 0, 0, 0, location), Value: 4},
+	}
+	filled, err := fillGaps(&data, "linear", "daily", 0, location)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*filled) != 4 {
+		t.Fatalf("fillGaps() returned %d samples; expected 4", len(*filled))
+	}
+	for i, tsPair := range *filled {
+		if expected := time.Date(2026, 3, 27+i, 0, 0, 0, 0, location); !tsPair.TS.Equal(expected) {
+			t.Errorf("fillGaps()[%d] at %v; expected %v", i, tsPair.TS, expected)
+		}
+	}
+}
+
+func TestFillGapsUnknownPolicy(t *testing.T) {
+	data := []model.TsPair{}
+	if _, err := fillGaps(&data, "spline", "", time.Minute, time.UTC); err == nil {
+		t.Error("fillGaps(spline) should fail")
+	}
+}
@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// QueryTimeOfUse sums the samples into the tariff buckets of the schedule named by query.Tariff, per day, week
+// or month (query.TimeModel, default "daily") in the timezone of the project. What is summed depends on
+// query.Aggregation;
+//
+//	"sum"      - the sample values, e.g. energy per poll interval (default)
+//	"delta"    - the increase between samples of a cumulative meter, where a decrease is a meter reset
+//	"integral" - the area under the curve in value-hours, e.g. kW -> kWh
+//
+// The increase between two samples is put in the bucket of the later sample.
+func (cass *CassandraClient) QueryTimeOfUse(ctx context.Context, org int64, query model.QueryRef, from time.Time, to time.Time) (model.TariffSchedule, []model.TimeOfUse, error) {
+	var schedule model.TariffSchedule
+	entry, err := cass.QueryKeyValues(ctx, org, "tariffs", query.Tariff)
+	if err != nil {
+		return schedule, nil, fmt.Errorf("tariff schedule %s: %w", query.Tariff, err)
+	}
+	if err := json.Unmarshal([]byte(entry.Value), &schedule); err != nil {
+		return schedule, nil, fmt.Errorf("%w: unmarshal tariff schedule %s: %w", model.ErrBadRequest, query.Tariff, err)
+	}
+	if err := schedule.Validate(); err != nil {
+		return schedule, nil, fmt.Errorf("%w: %w", model.ErrBadRequest, err)
+	}
+
+	var align func(*time.Time, *time.Location) time.Time
+	switch query.TimeModel {
+	case "", "daily":
+		align = alignDay
+	case "weekly":
+		align = alignWeek
+	case "monthly":
+		align = alignMonth
+	default:
+		return schedule, nil, fmt.Errorf("%w: time-of-use is per daily, weekly or monthly, not %s", model.ErrBadRequest, query.TimeModel)
+	}
+	increase, err := timeOfUseIncrease(strings.TrimSpace(query.Aggregation))
+	if err != nil {
+		return schedule, nil, err
+	}
+	project, err := cass.GetProject(ctx, org, query.Project)
+	if err != nil {
+		return schedule, nil, err
+	}
+	location := CreateLocation(project.Timezone)
+
+	var result []model.TimeOfUse
+	var previous *model.TsPair
+	err = cass.readPartitions(ctx, org, query, from, to, func(partition []model.TsPair) {
+		for i := range partition {
+			current := partition[i]
+			value, ok := increase(previous, &current)
+			previous = &current
+			if !ok {
+				continue
+			}
+			localTime := current.TS.In(location)
+			period := align(&localTime, location)
+			if n := len(result); n == 0 || !result[n-1].TS.Equal(period) {
+				result = append(result, model.TimeOfUse{TS: period, Buckets: make(map[string]float64)})
+			}
+			result[len(result)-1].Buckets[schedule.BucketOf(localTime)] += value
+		}
+	})
+	if err != nil {
+		return schedule, nil, fmt.Errorf("read timeseries: %w", err)
+	}
+	return schedule, result, nil
+}
+
+// timeOfUseIncrease returns the function for what a sample adds to its bucket. It returns false when the
+// sample adds nothing, i.e. for the first sample of a delta or integral.
+func timeOfUseIncrease(aggregation string) (func(previous *model.TsPair, current *model.TsPair) (float64, bool), error) {
+	switch aggregation {
+	case "", "sum":
+		return func(_ *model.TsPair, current *model.TsPair) (float64, bool) {
+			return current.Value, true
+		}, nil
+	case "delta":
+		return func(previous *model.TsPair, current *model.TsPair) (float64, bool) {
+			if previous == nil {
+				return 0, false
+			}
+			if current.Value < previous.Value {
+				return current.Value, true // the meter was reset
+			}
+			return current.Value - previous.Value, true
+		}, nil
+	case "integral":
+		return func(previous *model.TsPair, current *model.TsPair) (float64, bool) {
+			if previous == nil {
+				return 0, false
+			}
+			hours := current.TS.Sub(previous.TS).Hours()
+			return hours * (current.Value + previous.Value) / 2, true
+		}, nil
+	}
+	return nil, fmt.Errorf("%w: time-of-use is a sum, delta or integral, not %s", model.ErrBadRequest, aggregation)
+}
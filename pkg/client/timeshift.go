@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// queryShifted queries the time range query.TimeShift earlier, and moves the result forward onto the requested
+// time range, so that e.g. last week can be drawn on top of this week. The shift is done on the calendar of
+// the project's timezone, and the buckets of the time model are aligned again afterwards, since a week one
+// year ago doesn't start on the same day of the month.
+func (cass *CassandraClient) queryShifted(ctx context.Context, org int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) (*[]model.TsPair, error) {
+	amount, unit, err := parseTimeShift(query.TimeShift)
+	if err != nil {
+		return nil, err
+	}
+	project, err := cass.GetProject(ctx, org, query.Project)
+	if err != nil {
+		return nil, err
+	}
+	location := CreateLocation(project.Timezone)
+
+	unshifted := query
+	unshifted.TimeShift = ""
+	unshifted.CompareTo = nil
+	shiftedFrom := shiftTime(from, -amount, unit, location)
+	shiftedTo := shiftTime(to, -amount, unit, location)
+	data, err := cass.QueryTimeseries(ctx, org, unshifted, shiftedFrom, shiftedTo, maxValues)
+	if err != nil {
+		return nil, err
+	}
+
+	var align func(*time.Time, *time.Location) time.Time
+	if query.TimeModel != "" && query.Aggregation != "" && query.Aggregation != "sample" {
+		_, align, err = timeModelFuncs(query.TimeModel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	result := make([]model.TsPair, 0, len(*data))
+	for _, tsPair := range *data {
+		ts := shiftTime(tsPair.TS, amount, unit, location)
+		if align != nil {
+			ts = align(&ts, location)
+		}
+		if ts.After(to) {
+			continue // the shifted range is longer, e.g. a 31 day month compared to a 30 day month
+		}
+		if n := len(result); n > 0 && align != nil && result[n-1].TS.Equal(ts) {
+			continue // two buckets ended up on the same aligned time, keep the first
+		}
+		result = append(result, model.TsPair{TS: ts, Value: tsPair.Value})
+	}
+	return &result, nil
+}
+
+// parseTimeShift parses shifts like "30m", "1h", "7d", "1w", "1M" and "1y". Note that "m" is minutes and "M" is
+// months.
+func parseTimeShift(shift string) (int, byte, error) {
+	if len(shift) < 2 {
+		return 0, 0, fmt.Errorf("%w: invalid time shift: %s", model.ErrBadRequest, shift)
+	}
+	unit := shift[len(shift)-1]
+	amount, err := strconv.Atoi(shift[:len(shift)-1])
+	if err != nil || amount <= 0 {
+		// The shift is always into the past, e.g. "1w" is one week earlier.
+		return 0, 0, fmt.Errorf("%w: invalid time shift: %s", model.ErrBadRequest, shift)
+	}
+	switch unit {
+	case 'm', 'h', 'd', 'w', 'M', 'y':
+		return amount, unit, nil
+	}
+	return 0, 0, fmt.Errorf("%w: invalid time shift unit: %s", model.ErrBadRequest, shift)
+}
+
+// shiftTime moves the time by amount units. Days and longer are moved on the wall clock of the location, so
+// that midnight stays midnight across DST transitions.
+func shiftTime(tm time.Time, amount int, unit byte, location *time.Location) time.Time {
+	localTime := tm.In(location)
+	switch unit {
+	case 'm':
+		return localTime.Add(time.Duration(amount) * time.Minute)
+	case 'h':
+		return localTime.Add(time.Duration(amount) * time.Hour)
+	case 'd':
+		return localTime.AddDate(0, 0, amount)
+	case 'w':
+		return localTime.AddDate(0, 0, 7*amount)
+	case 'M':
+		return localTime.AddDate(0, amount, 0)
+	case 'y':
+		return localTime.AddDate(amount, 0, 0)
+	}
+	return localTime
+}
@@ -0,0 +1,103 @@
+package client
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// transform is applied on the raw samples, before they are reduced;
+//
+//	"rate"       - increase of a cumulative counter per time unit, handling counter resets and rollovers
+//	"derivative" - change per time unit, which may be negative
+//	"integral"   - the accumulated area under the curve (trapezoidal), e.g. kW -> kWh
+//
+// The time unit is "s", "m", "h" (default) or "d".
+func transform(data *[]model.TsPair, transformation string, unit string, counterMax float64) (*[]model.TsPair, error) {
+	if transformation == "" {
+		return data, nil
+	}
+	per, err := transformUnit(unit)
+	if err != nil {
+		return nil, err
+	}
+	switch transformation {
+	case "rate":
+		return rateOf(data, per, counterMax), nil
+	case "derivative":
+		return derivativeOf(data, per), nil
+	case "integral":
+		return cumulativeIntegralOf(data, per), nil
+	}
+	return nil, fmt.Errorf("%w: unknown transform: %s", model.ErrBadRequest, transformation)
+}
+
+func transformUnit(unit string) (time.Duration, error) {
+	switch unit {
+	case "s":
+		return time.Second, nil
+	case "m":
+		return time.Minute, nil
+	case "", "h":
+		return time.Hour, nil
+	case "d":
+		return 24 * time.Hour, nil
+	}
+	return 0, fmt.Errorf("%w: unknown transform unit: %s", model.ErrBadRequest, unit)
+}
+
+// rateOf treats a decreasing value as a rollover if counterMax is known, and otherwise as a counter that was
+// reset to zero.
+func rateOf(data *[]model.TsPair, per time.Duration, counterMax float64) *[]model.TsPair {
+	result := make([]model.TsPair, 0, len(*data))
+	for i := 1; i < len(*data); i++ {
+		previous := (*data)[i-1]
+		current := (*data)[i]
+		elapsed := current.TS.Sub(previous.TS)
+		if elapsed <= 0 {
+			continue
+		}
+		delta := current.Value - previous.Value
+		if delta < 0 {
+			if counterMax > 0 {
+				delta = counterMax - previous.Value + current.Value
+			} else {
+				delta = current.Value
+			}
+		}
+		result = append(result, model.TsPair{TS: current.TS, Value: delta * float64(per) / float64(elapsed)})
+	}
+	return &result
+}
+
+func derivativeOf(data *[]model.TsPair, per time.Duration) *[]model.TsPair {
+	result := make([]model.TsPair, 0, len(*data))
+	for i := 1; i < len(*data); i++ {
+		previous := (*data)[i-1]
+		current := (*data)[i]
+		elapsed := current.TS.Sub(previous.TS)
+		if elapsed <= 0 {
+			continue
+		}
+		result = append(result, model.TsPair{TS: current.TS, Value: (current.Value - previous.Value) * float64(per) / float64(elapsed)})
+	}
+	return &result
+}
+
+func cumulativeIntegralOf(data *[]model.TsPair, per time.Duration) *[]model.TsPair {
+	result := make([]model.TsPair, 0, len(*data))
+	if len(*data) == 0 {
+		return &result
+	}
+	integral := 0.0
+	result = append(result, model.TsPair{TS: (*data)[0].TS, Value: integral})
+	for i := 1; i < len(*data); i++ {
+		previous := (*data)[i-1]
+		current := (*data)[i]
+		units := float64(current.TS.Sub(previous.TS)) / float64(per)
+		integral = integral + units*(current.Value+previous.Value)/2
+		result = append(result, model.TsPair{TS: current.TS, Value: integral})
+	}
+	return &result
+}
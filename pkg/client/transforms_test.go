@@ -0,0 +1,83 @@
+package client
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func checkValues(t *testing.T, name string, result *[]model.TsPair, expected ...float64) {
+	t.Helper()
+	if len(*result) != len(expected) {
+		t.Fatalf("%s = %v; expected the values %v", name, *result, expected)
+	}
+	for i, tsPair := range *result {
+		if math.Abs(tsPair.Value-expected[i]) > 1e-9 {
+			t.Errorf("%s[%d] = %v; expected %v", name, i, tsPair.Value, expected[i])
+		}
+	}
+}
+
+func TestRateCounterReset(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Without counterMax, the value after the decrease is the increase since the reset to zero.
+	data := seriesOf(start, 30*time.Minute, 10, 20, 5, 15)
+	result, err := transform(&data, "rate", "h", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, "rate", result, 20, 10, 20)
+}
+
+func TestRateCounterRollover(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := seriesOf(start, time.Hour, 80, 95, 10)
+	result, err := transform(&data, "rate", "", 100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, "rate", result, 15, 15)
+}
+
+func TestNegativeDerivative(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := seriesOf(start, 30*time.Minute, 10, 4, 4, 7)
+	result, err := transform(&data, "derivative", "h", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, "derivative", result, -12, 0, 6)
+	if !(*result)[0].TS.Equal(start.Add(30 * time.Minute)) {
+		t.Errorf("the derivative is at %v; expected the later sample", (*result)[0].TS)
+	}
+}
+
+func TestIntegralOverGap(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	data := seriesOf(start, time.Hour, 2, 2)
+	// Three hours without samples, over which the value rises linearly from 2 to 4.
+	data = append(data, model.TsPair{TS: start.Add(4 * time.Hour), Value: 4})
+	result, err := transform(&data, "integral", "h", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, "integral", result, 0, 2, 11)
+
+	perMinute, err := transform(&data, "integral", "m", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkValues(t, "integral", perMinute, 0, 120, 660)
+}
+
+func TestTransformErrors(t *testing.T) {
+	data := []model.TsPair{}
+	if _, err := transform(&data, "logarithm", "", 0); err == nil {
+		t.Error("an unknown transform should fail")
+	}
+	if _, err := transform(&data, "rate", "y", 0); err == nil {
+		t.Error("an unknown transform unit should fail")
+	}
+}
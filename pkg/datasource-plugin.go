@@ -3,7 +3,10 @@ package main
 import (
 	"context"
 	JSON "encoding/json"
+	"errors"
 	"fmt"
+	"math"
+	"slices"
 	"strconv"
 	"strings"
 	"time"
@@ -28,18 +31,23 @@ type SensetifDatasource struct {
 	cassandraClient client.Cassandra
 }
 
-func (sds *SensetifDatasource) QueryData(_ context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
-	log.DefaultLogger.Info(fmt.Sprintf("QueryData: %d, %s -> %s", req.PluginContext.OrgID, req.PluginContext.User.Login, string(req.Queries[0].JSON)))
+func (sds *SensetifDatasource) QueryData(ctx context.Context, req *backend.QueryDataRequest) (*backend.QueryDataResponse, error) {
+	// There is no user when the alert rules are evaluated.
+	login := ""
+	if req.PluginContext.User != nil {
+		login = req.PluginContext.User.Login
+	}
+	log.DefaultLogger.Info(fmt.Sprintf("QueryData: %d, %s -> %d queries", req.PluginContext.OrgID, login, len(req.Queries)))
 	orgId := req.PluginContext.OrgID
 	response := backend.NewQueryDataResponse()
 	for _, q := range req.Queries {
-		res := sds.query(q.RefID, orgId, q)
+		res := sds.query(ctx, q.RefID, orgId, q)
 		response.Responses[q.RefID] = res
 	}
 	return response, nil
 }
 
-func (sds *SensetifDatasource) query(queryName string, orgId int64, query backend.DataQuery) backend.DataResponse {
+func (sds *SensetifDatasource) query(ctx context.Context, queryName string, orgId int64, query backend.DataQuery) backend.DataResponse {
 	var qm struct {
 		Format     string `json:"format"`
 		Parameters string `json:"parameters"`
@@ -50,48 +58,387 @@ func (sds *SensetifDatasource) query(queryName string, orgId int64, query backen
 	}
 
 	maxValues := int(query.MaxDataPoints)
-	return sds.executeTimeseriesQuery(queryName, maxValues, qm.Parameters, orgId, query)
+	return sds.executeTimeseriesQuery(ctx, queryName, maxValues, qm.Format, qm.Parameters, orgId, query)
 }
 
-func (sds *SensetifDatasource) executeTimeseriesQuery(queryName string, maxValues int /*parameters*/, _ string, orgId int64, query backend.DataQuery) backend.DataResponse {
+func (sds *SensetifDatasource) executeTimeseriesQuery(ctx context.Context, queryName string, maxValues int, format string /*parameters*/, _ string, orgId int64, query backend.DataQuery) backend.DataResponse {
 	from := query.TimeRange.From
 	to := query.TimeRange.To
 
-	var model model.QueryRef
-	if err := JSON.Unmarshal(query.JSON, &model); err != nil {
+	var queryRef model.QueryRef
+	if err := JSON.Unmarshal(query.JSON, &queryRef); err != nil {
 		return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("unmarshal query: %v", err))
 	}
 
-	var frame *data.Frame
-	if model.Project == "_" {
-		projects, _ := sds.cassandraClient.FindAllProjects(orgId)
-		frame = formatProjectsQuery(queryName, projects)
-	} else if model.Project == "_alarms" {
-		// alarmStates := sds.cassandraClient.QueryAlarmStates(orgId, model_)
-		// frame = FormatAlarmsQuery(queryName, alarmStates)
+	var frames data.Frames
+	if queryRef.Project == "_" {
+		projects, err := sds.cassandraClient.FindAllProjects(ctx, orgId)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("find projects: %v", err))
+		}
+		frames = append(frames, formatProjectsQuery(queryName, projects))
+	} else if queryRef.Project == "_alarms" {
+		alarmStates, err := sds.cassandraClient.QueryAlarmStates(ctx, orgId, queryRef, from, to)
+		if err != nil {
+			return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query alarm states: %v", err))
+		}
+		frames = append(frames, FormatAlarmsQuery(queryName, alarmStates))
+	} else if queryRef.Project == "_inventory" {
+		inventory, err := sds.findInventory(ctx, orgId)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("find inventory: %v", err))
+		}
+		frames = append(frames, formatDatapointsQuery(queryName, inventory))
+	} else if queryRef.Subsystem == "_" {
+		subsystems, err := sds.cassandraClient.FindAllSubsystems(ctx, orgId, queryRef.Project)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("find subsystems: %v", err))
+		}
+		frames = append(frames, formatSubsystemsQuery(queryName, subsystems))
+	} else if queryRef.Datapoint == "_" {
+		datapoints, err := sds.cassandraClient.FindAllDatapoints(ctx, orgId, queryRef.Project, queryRef.Subsystem)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("find datapoints: %v", err))
+		}
+		frames = append(frames, formatDatapointsQuery(queryName, datapoints))
+	} else if queryRef.Project == "_journal" {
+		journal, err := sds.cassandraClient.SelectRangeInJournal(ctx, orgId, queryRef.JournalType, queryRef.JournalName, from, to)
+		if err != nil {
+			return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query journal: %v", err))
+		}
+		if format == "annotations" {
+			frames = append(frames, formatJournalAnnotations(queryName, journal))
+		} else {
+			frames = append(frames, formatJournalQuery(queryName, journal))
+		}
+	} else if queryRef.Project == "_expression" {
+		timeseries, err := sds.executeExpressionQuery(ctx, orgId, queryRef, from, to, maxValues)
+		if err != nil {
+			return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("expression query: %v", err))
+		}
+		frames = append(frames, formatTimeseriesQuery(queryName, timeseries, nil, nil))
+	} else if queryRef.Rank != "" {
+		ranking, err := sds.executeRankingQuery(ctx, orgId, queryRef, from, to)
+		if err != nil {
+			return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("ranking query: %v", err))
+		}
+		frames = append(frames, formatRankingQuery(queryName, ranking))
+	} else if queryRef.Rollup != "" {
+		timeseries, datapoint, err := sds.executeRollupQuery(ctx, orgId, queryRef, from, to, maxValues)
+		if err != nil {
+			return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("rollup query: %v", err))
+		}
+		labels := data.Labels{"project": queryRef.Project, "datapoint": queryRef.Datapoint, "rollup": queryRef.Rollup}
+		config := fieldConfigOf(queryRef, datapoint)
+		config.DisplayNameFromDS = fmt.Sprintf("%s/%s (%s)", queryRef.Project, queryRef.Datapoint, queryRef.Rollup)
+		if queryRef.Rollup == "sum" {
+			config.Min, config.Max = nil, nil // the range is of a single datapoint
+		}
+		frames = append(frames, formatTimeseriesQuery(queryName, timeseries, labels, config))
 	} else {
-		timeseries := sds.cassandraClient.QueryTimeseries(orgId, model, from, to, maxValues)
-		frame = formatTimeseriesQuery(queryName, timeseries)
+		queryRefs, err := sds.expandQuery(ctx, orgId, queryRef)
+		if err != nil {
+			return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("expand query: %v", err))
+		}
+		expanded := isPattern(queryRef.Project) || isPattern(queryRef.Subsystem) || isPattern(queryRef.Datapoint)
+		for _, ref := range queryRefs {
+			datapoint, err := sds.cassandraClient.GetDatapoint(ctx, orgId, ref.Project, ref.Subsystem, ref.Datapoint)
+			if err != nil {
+				return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("find datapoint: %v", err))
+			}
+			labels := data.Labels{"project": ref.Project, "subsystem": ref.Subsystem}
+			if expanded {
+				labels["datapoint"] = ref.Datapoint
+			}
+			config := fieldConfigOf(ref, datapoint)
+			if ref.Tariff != "" {
+				schedule, usage, err := sds.cassandraClient.QueryTimeOfUse(ctx, orgId, ref, from, to)
+				if err != nil {
+					return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query time-of-use: %v", err))
+				}
+				frames = append(frames, formatTimeOfUseQuery(queryName, schedule, usage, labels, config))
+				continue
+			}
+			if ref.States {
+				// Every sample is needed, since a short state must not be lost by the reduction.
+				raw := model.QueryRef{Project: ref.Project, Subsystem: ref.Subsystem, Datapoint: ref.Datapoint}
+				timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, raw, from, to, 0)
+				if err != nil {
+					return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query timeseries: %v", err))
+				}
+				project, err := sds.cassandraClient.GetProject(ctx, orgId, ref.Project)
+				if err != nil {
+					return backend.ErrDataResponse(backend.StatusInternal, fmt.Sprintf("find project: %v", err))
+				}
+				intervals := statesOf(timeseries, datapoint.Interval.Duration(), to)
+				totals := stateTotalsOf(intervals, client.CreateLocation(project.Timezone))
+				frames = append(frames, formatStatesQuery(queryName, intervals, labels, config))
+				frames = append(frames, formatStateTotalsQuery(queryName, totals, labels, config))
+				continue
+			}
+			limit := maxValues
+			if ref.Reduce != "" || ref.Histogram != "" {
+				// The reduction and the histogram cover all the samples, not only those left after the cut to
+				// MaxDataPoints.
+				limit = 0
+			}
+			timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, ref, from, to, limit)
+			if err != nil {
+				return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query timeseries: %v", err))
+			}
+			if ref.Reduce != "" {
+				value, err := reduceTimeseries(timeseries, ref.Reduce)
+				if err != nil {
+					return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("reduce: %v", err))
+				}
+				frames = append(frames, formatReducedQuery(queryName, value, labels, config))
+				continue
+			}
+			if ref.Histogram != "" {
+				buckets, err := histogramOf(timeseries, ref.Histogram, ref.BucketWidth, ref.BucketCount, datapoint.Interval.Duration())
+				if err != nil {
+					return backend.ErrDataResponse(backend.StatusBadRequest, fmt.Sprintf("histogram: %v", err))
+				}
+				frames = append(frames, formatHistogramQuery(queryName, buckets, ref.Histogram, labels, config))
+				continue
+			}
+			history := formatTimeseriesQuery(queryName, timeseries, labels, config)
+			frames = append(frames, history)
+
+			// The history is still shown when the forecast or the anomaly scores fail, with the error as a notice.
+			if ref.Forecast != "" {
+				horizon, err := parseHorizon(ref.ForecastHorizon)
+				var points []forecastPoint
+				if err == nil {
+					points, err = forecast(timeseries, ref.Forecast, ref.Seasonality, to, horizon)
+				}
+				if err != nil {
+					history.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("forecast: %v", err)})
+				} else {
+					frames = append(frames, formatForecastQuery(queryName, points, labels))
+				}
+			}
+			if ref.Anomaly != "" {
+				scores, err := scoreAnomalies(timeseries, ref.Anomaly, ref.AnomalyWindow, ref.AnomalyThreshold, ref.Seasonality)
+				if err != nil {
+					history.AppendNotices(data.Notice{Severity: data.NoticeSeverityWarning, Text: fmt.Sprintf("anomaly: %v", err)})
+				} else {
+					frames = append(frames, formatAnomalyQuery(queryName, scores, labels))
+				}
+			}
+			for _, timeShift := range ref.CompareTo {
+				shifted := ref
+				shifted.TimeShift = timeShift
+				shifted.CompareTo = nil
+				timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, shifted, from, to, maxValues)
+				if err != nil {
+					return backend.ErrDataResponse(queryErrorStatus(err), fmt.Sprintf("query timeseries %s earlier: %v", timeShift, err))
+				}
+				shiftedLabels := data.Labels{"compareTo": timeShift}
+				for key, value := range labels {
+					shiftedLabels[key] = value
+				}
+				shiftedConfig := *config
+				shiftedConfig.DisplayNameFromDS = fmt.Sprintf("%s (%s earlier)", config.DisplayNameFromDS, timeShift)
+				frames = append(frames, formatTimeseriesQuery(queryName, timeseries, shiftedLabels, &shiftedConfig))
+			}
+		}
 	}
 
-	frame.RefID = query.RefID
+	for _, frame := range frames {
+		frame.RefID = query.RefID
+	}
 
 	return backend.DataResponse{
-		Frames: data.Frames{frame},
+		Frames: frames,
+	}
+}
+
+// queryErrorStatus tells Grafana whether the query was invalid, cut short by the request timeout, or failed in
+// the backend.
+func queryErrorStatus(err error) backend.Status {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		return backend.StatusTimeout
+	case errors.Is(err, model.ErrBadRequest):
+		return backend.StatusBadRequest
+	case errors.Is(err, model.ErrNotFound):
+		return backend.StatusNotFound
+	}
+	return backend.StatusInternal
+}
+
+// fieldConfigOf describes the values of the datapoint to Grafana. The unit is derived, or left out, when the
+// transform, the aggregation or the reduction changes what the values are, and so is the min/max range.
+func fieldConfigOf(ref model.QueryRef, datapoint model.DatapointSettings) *data.FieldConfig {
+	config := &data.FieldConfig{
+		DisplayNameFromDS: datapoint.Project + "/" + datapoint.Subsystem + "/" + datapoint.Name,
+	}
+	aggregation := strings.TrimSpace(ref.Aggregation)
+	unit := datapoint.Proc.Unit
+	switch ref.Transform {
+	case "":
+	case "integral":
+		unit = integralUnitOf(unit, ref.TransformUnit)
+	default:
+		unit = ""
+	}
+	switch aggregation {
+	case "count", "variance", "hdd", "cdd":
+		unit = ""
+	case "integral":
+		unit = integralUnitOf(unit, "h")
+	}
+	if ref.Reduce == "count" {
+		unit = ""
 	}
+	config.Unit = unit
+	sameRange := false
+	switch aggregation {
+	case "", "sample", "first", "min", "max", "average", "median":
+		sameRange = true
+	default:
+		// Percentiles, such as "p95"
+		_, err := strconv.ParseFloat(strings.TrimPrefix(aggregation, "p"), 64)
+		sameRange = strings.HasPrefix(aggregation, "p") && err == nil
+	}
+	proc := datapoint.Proc
+	if sameRange && ref.Transform == "" && ref.Reduce != "count" && ref.Reduce != "sum" && proc.Min < proc.Max {
+		// The unset limits are stored as -/+ math.MaxFloat64
+		if proc.Min > -math.MaxFloat64 {
+			config.SetMin(proc.Min)
+		}
+		if proc.Max < math.MaxFloat64 {
+			config.SetMax(proc.Max)
+		}
+	}
+	return config
+}
+
+// integralUnitOf returns the unit of the area under the curve per the time unit; "m3/h" gives "m3" per hour,
+// and the power units give the energy units per hour, such as "kW" -> "kWh". It is empty for other units.
+func integralUnitOf(unit string, per string) string {
+	if per == "" {
+		per = "h"
+	}
+	if strings.HasSuffix(unit, "/"+per) {
+		return strings.TrimSuffix(unit, "/"+per)
+	}
+	if per == "h" && slices.Contains([]string{"W", "kW", "MW", "GW"}, unit) {
+		return unit + "h"
+	}
+	return ""
 }
 
-func formatTimeseriesQuery(queryName string, timeseries *[]model.TsPair) *data.Frame {
+// formatTimeseriesQuery returns the series in ascending time order, as the time series multi format requires,
+// while e.g. reduceDefault() returns the newest sample first.
+func formatTimeseriesQuery(queryName string, timeseries *[]model.TsPair, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	series := *timeseries
+	compareTs := func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	}
+	if !slices.IsSortedFunc(series, compareTs) {
+		// A copy, since the series may be shared with the cache.
+		series = slices.Clone(series)
+		slices.SortFunc(series, compareTs)
+	}
 	times := []time.Time{}
 	values := []float64{}
-	for _, t := range *timeseries {
+	nullable := false
+	for _, t := range series {
 		times = append(times, t.TS)
 		values = append(values, t.Value)
+		nullable = nullable || math.IsNaN(t.Value)
 	}
+	var valueField *data.Field
+	if nullable {
+		// NaN marks the gaps that are filled with nulls.
+		nullableValues := make([]*float64, len(values))
+		for i := range values {
+			if !math.IsNaN(values[i]) {
+				nullableValues[i] = &values[i]
+			}
+		}
+		valueField = data.NewField("Value", labels, nullableValues)
+	} else {
+		valueField = data.NewField("Value", labels, values)
+	}
+	valueField.Config = config
 	frame := data.NewFrame(queryName,
 		data.NewField("Time", nil, times),
+		valueField,
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTimeSeriesMulti, TypeVersion: data.FrameTypeVersion{0, 1}}
+	return frame
+}
+
+func FormatAlarmsQuery(queryName string, alarmStates []model.AlarmState) *data.Frame {
+	times := []time.Time{}
+	states := []string{}
+	severities := []string{}
+	projects := []string{}
+	subsystems := []string{}
+	datapoints := []string{}
+	values := []float64{}
+	messages := []string{}
+	for _, a := range alarmStates {
+		times = append(times, a.TS)
+		states = append(states, a.State)
+		severities = append(severities, a.Severity)
+		projects = append(projects, a.Project)
+		subsystems = append(subsystems, a.Subsystem)
+		datapoints = append(datapoints, a.Datapoint)
+		values = append(values, a.Value)
+		messages = append(messages, a.Message)
+	}
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, times),
+		data.NewField("State", nil, states),
+		data.NewField("Severity", nil, severities),
+		data.NewField("Project", nil, projects),
+		data.NewField("Subsystem", nil, subsystems),
+		data.NewField("Datapoint", nil, datapoints),
 		data.NewField("Value", nil, values),
+		data.NewField("Message", nil, messages),
+	)
+}
+
+func formatJournalQuery(queryName string, journal model.Journal) *data.Frame {
+	times := []time.Time{}
+	types := []string{}
+	names := []string{}
+	values := []string{}
+	for _, entry := range journal.Entries {
+		times = append(times, entry.Added)
+		types = append(types, journal.Type)
+		names = append(names, journal.Name)
+		values = append(values, entry.Value)
+	}
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, times),
+		data.NewField("Type", nil, types),
+		data.NewField("Name", nil, names),
+		data.NewField("Value", nil, values),
+	)
+}
+
+// formatJournalAnnotations uses the field names of Grafana annotations, so the entries are shown as markers
+// on the time series panels.
+func formatJournalAnnotations(queryName string, journal model.Journal) *data.Frame {
+	times := []time.Time{}
+	titles := []string{}
+	texts := []string{}
+	for _, entry := range journal.Entries {
+		times = append(times, entry.Added)
+		titles = append(titles, journal.Name)
+		texts = append(texts, entry.Value)
+	}
+	frame := data.NewFrame(queryName,
+		data.NewField("time", nil, times),
+		data.NewField("title", nil, titles),
+		data.NewField("text", nil, texts),
 	)
+	frame.Meta = &data.FrameMeta{DataTopic: data.DataTopicAnnotations}
 	return frame
 }
 
@@ -100,9 +447,11 @@ func formatProjectsQuery(queryName string, projects []model.ProjectSettings) *da
 	longs := []float64{}
 	titles := []string{}
 	for _, t := range projects {
-		latlong := strings.Split(t.Geolocation, ",")
-		lat, _ := strconv.ParseFloat(strings.TrimSpace(latlong[0]), 32)
-		lng, _ := strconv.ParseFloat(strings.TrimSpace(latlong[1]), 32)
+		var lat, lng float64
+		if latitude, longitude, found := strings.Cut(t.Geolocation, ","); found {
+			lat, _ = strconv.ParseFloat(strings.TrimSpace(latitude), 32)
+			lng, _ = strconv.ParseFloat(strings.TrimSpace(longitude), 32)
+		}
 		lats = append(lats, lat)
 		longs = append(longs, lng)
 		titles = append(titles, t.Title)
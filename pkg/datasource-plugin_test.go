@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func TestFieldConfigUnit(t *testing.T) {
+	datapoint := model.DatapointSettings{Proc: model.Processing{Unit: "kW", Min: 0, Max: 100}}
+	cases := []struct {
+		ref  model.QueryRef
+		unit string
+	}{
+		{model.QueryRef{}, "kW"},
+		{model.QueryRef{Aggregation: "average", TimeModel: "daily"}, "kW"},
+		{model.QueryRef{Aggregation: "integral", TimeModel: "daily"}, "kWh"},
+		{model.QueryRef{Transform: "integral"}, "kWh"},
+		{model.QueryRef{Transform: "integral", TransformUnit: "s"}, ""},
+		{model.QueryRef{Transform: "derivative"}, ""},
+		{model.QueryRef{Aggregation: "count", TimeModel: "daily"}, ""},
+		{model.QueryRef{Reduce: "count"}, ""},
+		{model.QueryRef{Reduce: "max"}, "kW"},
+	}
+	for _, c := range cases {
+		if config := fieldConfigOf(c.ref, datapoint); config.Unit != c.unit {
+			t.Errorf("fieldConfigOf(%+v) has the unit %q; expected %q", c.ref, config.Unit, c.unit)
+		}
+	}
+	if config := fieldConfigOf(model.QueryRef{Reduce: "count"}, datapoint); config.Min != nil || config.Max != nil {
+		t.Error("a count should not have the range of the datapoint")
+	}
+}
+
+func TestIntegralUnit(t *testing.T) {
+	cases := map[[2]string]string{{"kW", ""}: "kWh", {"W", "h"}: "Wh", {"m3/h", "h"}: "m3", {"l/m", "m"}: "l", {"°C", "h"}: "", {"kW", "d"}: ""}
+	for c, expected := range cases {
+		if unit := integralUnitOf(c[0], c[1]); unit != expected {
+			t.Errorf("integralUnitOf(%q, %q) = %q; expected %q", c[0], c[1], unit, expected)
+		}
+	}
+}
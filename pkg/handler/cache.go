@@ -0,0 +1,25 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+func CacheStatistics(_ int64, _ ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
+	log.DefaultLogger.Info("CacheStatistics()")
+	rawJson, err := json.Marshal(clients.Cassandra.CacheStatistics())
+	if err != nil {
+		log.DefaultLogger.Error("Unable to marshal json")
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	return &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   rawJson,
+	}, nil
+}
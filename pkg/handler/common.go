@@ -1,7 +1,10 @@
 package handler
 
+import "net/url"
+
 type ResourceRequest struct {
 	Params []string
+	Query  url.Values
 	Body   []byte
 }
 
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -16,7 +17,7 @@ func ListDatapoints(orgId int64, req ResourceRequest, clients *client.Clients) (
 	if len(req.Params) < 3 {
 		return nil, fmt.Errorf("%w: missing params: \"%v\"", model.ErrBadRequest, req.Params)
 	}
-	datapoints, err := clients.Cassandra.FindAllDatapoints(orgId, req.Params[1], req.Params[2])
+	datapoints, err := clients.Cassandra.FindAllDatapoints(context.Background(), orgId, req.Params[1], req.Params[2])
 	if err != nil {
 		log.DefaultLogger.Error("Unable read datapoint.")
 		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
@@ -36,7 +37,7 @@ func GetDatapoint(orgId int64, req ResourceRequest, clients *client.Clients) (*b
 	if len(req.Params) < 4 {
 		return nil, fmt.Errorf("%w: missing params: \"%v\"", model.ErrBadRequest, req.Params)
 	}
-	datapoint, err := clients.Cassandra.GetDatapoint(orgId, req.Params[1], req.Params[2], req.Params[3])
+	datapoint, err := clients.Cassandra.GetDatapoint(context.Background(), orgId, req.Params[1], req.Params[2], req.Params[3])
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
 	}
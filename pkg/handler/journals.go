@@ -0,0 +1,131 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+const (
+	defaultJournalPageSize = 100
+	maxJournalPageSize     = 1000
+)
+
+type JournalPage struct {
+	model.Journal
+	Next *time.Time `json:"next,omitempty"` // the "from" of the next page, if there are more entries
+}
+
+type JournalEntryMessage struct {
+	Organization int64     `json:"organization"`
+	Type         string    `json:"type"`
+	Name         string    `json:"name"`
+	Added        time.Time `json:"added"`
+	Value        string    `json:"value"`
+}
+
+func ListJournals(orgId int64, req ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
+	log.DefaultLogger.Info("ListJournals()")
+	if len(req.Params) < 2 {
+		return nil, fmt.Errorf("%w: missing params: \"%v\"", model.ErrBadRequest, req.Params)
+	}
+	names, err := clients.Cassandra.FindAllJournalNames(orgId, req.Params[1])
+	if err != nil {
+		log.DefaultLogger.Error("Unable to read journals.")
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	rawJson, err := json.Marshal(names)
+	if err != nil {
+		log.DefaultLogger.Error("Unable to marshal json")
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	return &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   rawJson,
+	}, nil
+}
+
+// GetJournal returns a page of journal entries. The query parameters "from" and "to" are RFC3339 timestamps,
+// defaulting to all entries until now, and "limit" is the page size.
+func GetJournal(orgId int64, req ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
+	log.DefaultLogger.Info("GetJournal()")
+	if len(req.Params) < 3 {
+		return nil, fmt.Errorf("%w: missing params: \"%v\"", model.ErrBadRequest, req.Params)
+	}
+	from := time.Unix(0, 0)
+	to := time.Now()
+	limit := defaultJournalPageSize
+	var err error
+	if value := req.Query.Get("from"); value != "" {
+		if from, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%w: invalid 'from': %s", model.ErrBadRequest, err.Error())
+		}
+	}
+	if value := req.Query.Get("to"); value != "" {
+		if to, err = time.Parse(time.RFC3339, value); err != nil {
+			return nil, fmt.Errorf("%w: invalid 'to': %s", model.ErrBadRequest, err.Error())
+		}
+	}
+	if value := req.Query.Get("limit"); value != "" {
+		if limit, err = strconv.Atoi(value); err != nil || limit <= 0 {
+			return nil, fmt.Errorf("%w: invalid 'limit': %s", model.ErrBadRequest, value)
+		}
+		limit = min(limit, maxJournalPageSize)
+	}
+
+	journal, err := clients.Cassandra.SelectPageInJournal(orgId, req.Params[1], req.Params[2], from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	page := JournalPage{Journal: journal}
+	if len(journal.Entries) == limit {
+		// Cassandra timestamps have millisecond precision.
+		next := journal.Entries[len(journal.Entries)-1].Added.Add(time.Millisecond)
+		page.Next = &next
+	}
+	bytes, err := json.Marshal(page)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	return &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   bytes,
+	}, nil
+}
+
+func AddJournalEntry(orgId int64, req ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
+	log.DefaultLogger.Info("AddJournalEntry()")
+	if len(req.Params) < 3 {
+		return nil, fmt.Errorf("%w: missing params: \"%v\"", model.ErrBadRequest, req.Params)
+	}
+	var entry model.JournalEntry
+	if err := json.Unmarshal(req.Body, &entry); err != nil {
+		log.DefaultLogger.Error("Invalid format: " + err.Error())
+		return nil, fmt.Errorf("%w: invalid format: %s", model.ErrBadRequest, err.Error())
+	}
+	if entry.Added.IsZero() {
+		entry.Added = time.Now()
+	}
+	bytes, err := json.Marshal(JournalEntryMessage{
+		Organization: orgId,
+		Type:         req.Params[1],
+		Name:         req.Params[2],
+		Added:        entry.Added,
+		Value:        entry.Value,
+	})
+	if err != nil {
+		return nil, err
+	}
+	key := "2:" + strconv.FormatInt(orgId, 10) + ":addJournalEntry"
+	clients.Pulsar.Send(model.ConfigurationTopic, key, bytes)
+	return &backend.CallResourceResponse{
+		Status: http.StatusAccepted,
+	}, nil
+}
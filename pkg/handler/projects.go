@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -14,7 +15,7 @@ import (
 
 func ListProjects(orgId int64, _ ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
 	log.DefaultLogger.Info("ListProjects()")
-	projects, err := clients.Cassandra.FindAllProjects(orgId)
+	projects, err := clients.Cassandra.FindAllProjects(context.Background(), orgId)
 	if err != nil {
 		log.DefaultLogger.Error("Unable to read project.")
 		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
@@ -32,7 +33,7 @@ func ListProjects(orgId int64, _ ResourceRequest, clients *client.Clients) (*bac
 
 func GetProject(orgId int64, req ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
 	log.DefaultLogger.Info("GetProject()")
-	project, err := clients.Cassandra.GetProject(orgId, req.Params[1])
+	project, err := clients.Cassandra.GetProject(context.Background(), orgId, req.Params[1])
 	if err != nil {
 		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
 	}
@@ -1,6 +1,7 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -17,7 +18,7 @@ func ListSubsystems(orgId int64, req ResourceRequest, clients *client.Clients) (
 		return nil, fmt.Errorf("%w: missing req.Params: \"%v\"", model.ErrBadRequest, req.Params)
 	}
 
-	subsystems, err := clients.Cassandra.FindAllSubsystems(orgId, req.Params[1])
+	subsystems, err := clients.Cassandra.FindAllSubsystems(context.Background(), orgId, req.Params[1])
 	if err != nil {
 		log.DefaultLogger.Error("Unable to read subsystems")
 		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
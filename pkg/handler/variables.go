@@ -0,0 +1,108 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/backend"
+	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
+)
+
+// VariableValue is the shape of Grafana's MetricFindValue.
+type VariableValue struct {
+	Text  string `json:"text"`
+	Value string `json:"value"`
+}
+
+// FindVariableValues returns the values for dashboard template variables. The query parameters are;
+//
+//	type      - "projects", "subsystems" or "datapoints"
+//	project   - required for subsystems and datapoints
+//	subsystem - required for datapoints
+//	regex     - optional filter on the names
+//	sort      - optional "asc" or "desc", on the text
+func FindVariableValues(orgId int64, req ResourceRequest, clients *client.Clients) (*backend.CallResourceResponse, error) {
+	log.DefaultLogger.Info("FindVariableValues()")
+	var filter *regexp.Regexp
+	if pattern := req.Query.Get("regex"); pattern != "" {
+		var err error
+		if filter, err = regexp.Compile(pattern); err != nil {
+			return nil, fmt.Errorf("%w: invalid 'regex': %s", model.ErrBadRequest, err.Error())
+		}
+	}
+
+	values := make([]VariableValue, 0)
+	add := func(name string, title string) {
+		if filter != nil && !filter.MatchString(name) {
+			return
+		}
+		if title == "" {
+			title = name
+		}
+		values = append(values, VariableValue{Text: title, Value: name})
+	}
+	project := req.Query.Get("project")
+	subsystem := req.Query.Get("subsystem")
+	switch req.Query.Get("type") {
+	case "projects":
+		projects, err := clients.Cassandra.FindAllProjects(context.Background(), orgId)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+		}
+		for _, p := range projects {
+			add(p.Name, p.Title)
+		}
+	case "subsystems":
+		if project == "" {
+			return nil, fmt.Errorf("%w: missing 'project'", model.ErrBadRequest)
+		}
+		subsystems, err := clients.Cassandra.FindAllSubsystems(context.Background(), orgId, project)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+		}
+		for _, s := range subsystems {
+			add(s.Name, s.Title)
+		}
+	case "datapoints":
+		if project == "" || subsystem == "" {
+			return nil, fmt.Errorf("%w: missing 'project' or 'subsystem'", model.ErrBadRequest)
+		}
+		datapoints, err := clients.Cassandra.FindAllDatapoints(context.Background(), orgId, project, subsystem)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+		}
+		for _, d := range datapoints {
+			add(d.Name, "")
+		}
+	default:
+		return nil, fmt.Errorf("%w: invalid 'type': %s", model.ErrBadRequest, req.Query.Get("type"))
+	}
+
+	switch req.Query.Get("sort") {
+	case "asc":
+		sort.SliceStable(values, func(i, j int) bool {
+			return strings.ToLower(values[i].Text) < strings.ToLower(values[j].Text)
+		})
+	case "desc":
+		sort.SliceStable(values, func(i, j int) bool {
+			return strings.ToLower(values[i].Text) > strings.ToLower(values[j].Text)
+		})
+	}
+
+	rawJson, err := json.Marshal(values)
+	if err != nil {
+		log.DefaultLogger.Error("Unable to marshal json")
+		return nil, fmt.Errorf("%w: %s", model.ErrUnprocessableEntity, err.Error())
+	}
+	return &backend.CallResourceResponse{
+		Status: http.StatusOK,
+		Body:   rawJson,
+	}, nil
+}
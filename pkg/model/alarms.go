@@ -3,6 +3,12 @@ package model
 import "time"
 
 type AlarmState struct {
-	TS    time.Time `json:"ts"`
-	Value float64   `json:"value"`
+	TS        time.Time `json:"ts"`
+	Value     float64   `json:"value"`
+	State     string    `json:"state"`
+	Severity  string    `json:"severity"`
+	Project   string    `json:"project"`
+	Subsystem string    `json:"subsystem"`
+	Datapoint string    `json:"datapoint"`
+	Message   string    `json:"message"`
 }
@@ -1,5 +1,7 @@
 package model
 
+import "time"
+
 type PollInterval string
 
 // PollInterval values
@@ -37,3 +39,38 @@ var (
 		Monthly,
 	}
 )
+
+// Duration is the nominal time between two polls, where Monthly is counted as 30 days.
+func (p PollInterval) Duration() time.Duration {
+	switch p {
+	case One_minute:
+		return time.Minute
+	case Five_minutes:
+		return 5 * time.Minute
+	case Ten_minutes:
+		return 10 * time.Minute
+	case Fifteen_minutes:
+		return 15 * time.Minute
+	case Twenty_minutes:
+		return 20 * time.Minute
+	case Thirty_minutes:
+		return 30 * time.Minute
+	case One_hour:
+		return time.Hour
+	case Two_hours:
+		return 2 * time.Hour
+	case Three_hours:
+		return 3 * time.Hour
+	case Six_hours:
+		return 6 * time.Hour
+	case Twelve_hours:
+		return 12 * time.Hour
+	case One_day:
+		return 24 * time.Hour
+	case Weekly:
+		return 7 * 24 * time.Hour
+	case Monthly:
+		return 30 * 24 * time.Hour
+	}
+	return 0
+}
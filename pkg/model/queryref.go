@@ -4,6 +4,76 @@ type QueryRef struct {
 	Project     string
 	Subsystem   string
 	Datapoint   string
-	Aggregation string
+	Aggregation string // also "hdd" and "cdd", for heating and cooling degree days relative to BaseTemperature
 	TimeModel   string
+	Downsample  string // "", "lttb" or "minmax". Replaces the default decimation, without TimeModel and Aggregation.
+	Fill        string // "", "none", "null", "previous", "linear" or "zero". How gaps in the timeseries are filled.
+
+	// Transform is applied before the aggregation; "", "rate", "derivative" or "integral", per TransformUnit;
+	// "s", "m", "h" or "d". CounterMax is where a cumulative meter rolls over, if known.
+	Transform     string
+	TransformUnit string
+	CounterMax    float64
+
+	// JournalType and JournalName selects the journal when Project is "_journal".
+	JournalType string
+	JournalName string
+
+	// AlarmProject selects the project of the alarm states when Project is "_alarms", and all the projects of
+	// the organization if empty.
+	AlarmProject string
+
+	// Expression is evaluated when Project is "_expression", with the identifiers in the expression
+	// referring to the aliases in Refs. Example; "heat_out / power_in"
+	Expression string
+	Refs       map[string]QueryRef
+
+	// TimeShift queries an earlier period and moves it onto the requested time range; e.g. "1w", "1M" or "1y".
+	// CompareTo adds one extra series per time shift, next to the unshifted one.
+	TimeShift string
+	CompareTo []string
+
+	// Reduce returns a single number per series instead of the series, e.g. for alert rules; "last", "first",
+	// "min", "max", "mean", "sum" or "count".
+	Reduce string
+
+	// Tariff is the name of a TariffSchedule, which splits the sums of each day, week or month into the
+	// tariff buckets, instead of returning the series.
+	Tariff string
+
+	// BaseTemperature of the "hdd" and "cdd" aggregations, 18 if not given.
+	BaseTemperature *float64
+
+	// Histogram returns the distribution of the values instead of the series; "count" for the number of samples
+	// or "duration" for the hours in each bucket. The buckets are BucketWidth wide, or else BucketCount equally
+	// wide buckets between the smallest and the largest value.
+	Histogram   string
+	BucketWidth float64
+	BucketCount int
+
+	// States returns the intervals of equal values instead of the series, e.g. for pumps and doors stored as
+	// 0 and 1, together with the running hours and the number of starts per day.
+	States bool
+
+	// Rank returns a table of the "top" or "bottom" Limit (default 10) series, by the Aggregation over the
+	// whole time range, instead of the series. The Project, Subsystem and Datapoint are typically patterns.
+	Rank  string
+	Limit int
+
+	// Rollup combines the Datapoint of all subsystems of the project, or of the ones matching Subsystem, into
+	// one series; "sum", "average", "min" or "max".
+	Rollup string
+
+	// Forecast adds a projection of the series, "linear" or "holtwinters", until ForecastHorizon past the end
+	// of the time range; e.g. "7d" or "36h". Seasonality is "daily" or "weekly", for Holt-Winters.
+	Forecast        string
+	ForecastHorizon string
+	Seasonality     string
+
+	// Anomaly adds a score of each sample against its baseline, "zscore" or "mad", and flags the samples with
+	// an absolute score above AnomalyThreshold. AnomalyWindow is the number of samples for "zscore" and the
+	// number of seasons for "mad". Zero values gives the defaults.
+	Anomaly          string
+	AnomalyWindow    int
+	AnomalyThreshold float64
 }
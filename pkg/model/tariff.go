@@ -0,0 +1,84 @@
+package model
+
+import (
+	"fmt"
+	"slices"
+	"time"
+)
+
+// TariffSchedule splits the time into tariff buckets, such as "peak", "offpeak" and "weekend", in the timezone
+// of the project. It is stored as JSON in the keyvalues, with type "tariffs" and the name of the schedule as key.
+type TariffSchedule struct {
+	Periods       []TariffPeriod     `json:"periods"`       // the first matching period decides the bucket
+	Default       string             `json:"default"`       // bucket of the hours that no period matches
+	Holidays      []string           `json:"holidays"`      // dates, as "2006-01-02"
+	HolidayBucket string             `json:"holidayBucket"` // bucket of the holidays, Default if empty
+	Prices        map[string]float64 `json:"prices"`        // optional price per unit, for each bucket
+}
+
+type TariffPeriod struct {
+	Bucket   string         `json:"bucket"`
+	Weekdays []time.Weekday `json:"weekdays"` // 0 is Sunday, and all days if empty
+	From     int            `json:"from"`     // hour of the day, inclusive
+	To       int            `json:"to"`       // hour of the day, exclusive, where 24 is midnight
+}
+
+// TimeOfUse is the sum of each tariff bucket, for a day, week or month.
+type TimeOfUse struct {
+	TS      time.Time          `json:"ts"`
+	Buckets map[string]float64 `json:"buckets"`
+}
+
+func (s *TariffSchedule) Validate() error {
+	if s.Default == "" {
+		return fmt.Errorf("tariff schedule has no default bucket")
+	}
+	for _, p := range s.Periods {
+		if p.Bucket == "" {
+			return fmt.Errorf("tariff period has no bucket")
+		}
+		if p.From < 0 || p.To > 24 || p.From >= p.To {
+			return fmt.Errorf("tariff period %s has invalid hours %d-%d", p.Bucket, p.From, p.To)
+		}
+	}
+	for _, holiday := range s.Holidays {
+		if _, err := time.Parse(time.DateOnly, holiday); err != nil {
+			return fmt.Errorf("invalid holiday: %s", holiday)
+		}
+	}
+	return nil
+}
+
+// BucketOf returns the tariff bucket of the local time.
+func (s *TariffSchedule) BucketOf(localTime time.Time) string {
+	if slices.Contains(s.Holidays, localTime.Format(time.DateOnly)) {
+		if s.HolidayBucket != "" {
+			return s.HolidayBucket
+		}
+		return s.Default
+	}
+	hour := localTime.Hour()
+	for _, p := range s.Periods {
+		if hour >= p.From && hour < p.To && (len(p.Weekdays) == 0 || slices.Contains(p.Weekdays, localTime.Weekday())) {
+			return p.Bucket
+		}
+	}
+	return s.Default
+}
+
+// BucketNames returns all the buckets of the schedule; the default and the holiday buckets first, followed by
+// the buckets of the periods in order.
+func (s *TariffSchedule) BucketNames() []string {
+	var names []string
+	for _, name := range []string{s.Default, s.HolidayBucket} {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	for _, p := range s.Periods {
+		if !slices.Contains(names, p.Bucket) {
+			names = append(names, p.Bucket)
+		}
+	}
+	return names
+}
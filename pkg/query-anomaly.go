@@ -0,0 +1,185 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type anomalyScore struct {
+	ts      time.Time
+	score   *float64 // nil when there is not enough baseline, or no spread in it, to score the sample
+	anomaly bool
+}
+
+// scoreAnomalies scores each sample against a baseline of the samples before it;
+//
+//	"zscore" - standard score against the mean and standard deviation of the previous window samples.
+//	           Default window is 30 samples and default threshold is 3.
+//	"mad"    - modified z-score against the median and the median absolute deviation of the samples at the
+//	           same time of day (or week) in the previous window seasons, which doesn't flag the normal
+//	           daily cycle. Default window is 4 seasons and default threshold is 3.5.
+//
+// A sample is an anomaly if the absolute score is above the threshold, or if it differs from a baseline without
+// spread.
+func scoreAnomalies(timeseries *[]model.TsPair, method string, window int, threshold float64, seasonality string) ([]anomalyScore, error) {
+	series := make([]model.TsPair, 0, len(*timeseries))
+	for _, tsPair := range *timeseries {
+		if !math.IsNaN(tsPair.Value) {
+			series = append(series, tsPair)
+		}
+	}
+	slices.SortFunc(series, func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	})
+	switch method {
+	case "zscore":
+		if window <= 0 {
+			window = 30
+		}
+		if threshold <= 0 {
+			threshold = 3
+		}
+		return rollingZScores(series, window, threshold), nil
+	case "mad":
+		if window <= 0 {
+			window = 4
+		}
+		if threshold <= 0 {
+			threshold = 3.5
+		}
+		var period time.Duration
+		switch seasonality {
+		case "", "daily":
+			period = 24 * time.Hour
+		case "weekly":
+			period = 7 * 24 * time.Hour
+		default:
+			return nil, fmt.Errorf("unknown seasonality: %s", seasonality)
+		}
+		return seasonalMadScores(series, window, threshold, period), nil
+	}
+	return nil, fmt.Errorf("unknown anomaly method: %s", method)
+}
+
+// rollingZScores recomputes the mean and the variance for each window, since running sums of the squares lose
+// the precision of the variance when the values are large compared to their spread.
+func rollingZScores(series []model.TsPair, window int, threshold float64) []anomalyScore {
+	result := make([]anomalyScore, 0, len(series))
+	for i, tsPair := range series {
+		score := anomalyScore{ts: tsPair.TS}
+		if i >= window {
+			baseline := series[i-window : i]
+			mean := 0.0
+			for _, sample := range baseline {
+				mean = mean + sample.Value
+			}
+			mean = mean / float64(window)
+			variance := 0.0
+			for _, sample := range baseline {
+				variance = variance + (sample.Value-mean)*(sample.Value-mean)
+			}
+			variance = variance / float64(window)
+			score.score, score.anomaly = scoreOf(tsPair.Value, mean, math.Sqrt(variance), threshold)
+		}
+		result = append(result, score)
+	}
+	return result
+}
+
+// scoreOf returns the score of the value against the center and the spread of the baseline. A baseline without
+// spread, e.g. from a stuck sensor, gives no score, but every value that differs from it is an anomaly.
+func scoreOf(value float64, center float64, spread float64, threshold float64) (*float64, bool) {
+	if spread == 0 {
+		return nil, value != center
+	}
+	z := (value - center) / spread
+	return &z, math.Abs(z) > threshold
+}
+
+func seasonalMadScores(series []model.TsPair, seasons int, threshold float64, period time.Duration) []anomalyScore {
+	// Samples of earlier seasons are accepted if they are less than half the typical spacing off.
+	tolerance := client.MedianSpacing(series) / 2
+	result := make([]anomalyScore, 0, len(series))
+	baseline := make([]float64, 0, seasons)
+	deviations := make([]float64, 0, seasons)
+	for _, tsPair := range series {
+		score := anomalyScore{ts: tsPair.TS}
+		baseline = baseline[:0]
+		for k := 1; k <= seasons; k++ {
+			if value, found := nearestValue(series, tsPair.TS.Add(-time.Duration(k)*period), tolerance); found {
+				baseline = append(baseline, value)
+			}
+		}
+		if len(baseline) >= 3 {
+			median := medianOf(baseline)
+			deviations = deviations[:0]
+			for _, value := range baseline {
+				deviations = append(deviations, math.Abs(value-median))
+			}
+			// The modified z-score is 0.6745 * (value - median) / mad.
+			score.score, score.anomaly = scoreOf(tsPair.Value, median, medianOf(deviations)/0.6745, threshold)
+		}
+		result = append(result, score)
+	}
+	return result
+}
+
+// nearestValue finds the value of the sample closest to ts in the sorted series, if it is within the tolerance.
+func nearestValue(series []model.TsPair, ts time.Time, tolerance time.Duration) (float64, bool) {
+	index := sort.Search(len(series), func(i int) bool {
+		return !series[i].TS.Before(ts)
+	})
+	best := -1
+	for _, candidate := range []int{index - 1, index} {
+		if candidate < 0 || candidate >= len(series) {
+			continue
+		}
+		if best < 0 || absDuration(series[candidate].TS.Sub(ts)) < absDuration(series[best].TS.Sub(ts)) {
+			best = candidate
+		}
+	}
+	if best < 0 || absDuration(series[best].TS.Sub(ts)) > tolerance {
+		return 0, false
+	}
+	return series[best].Value, true
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+func medianOf(values []float64) float64 {
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	middle := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[middle-1] + sorted[middle]) / 2
+	}
+	return sorted[middle]
+}
+
+func formatAnomalyQuery(queryName string, scores []anomalyScore, labels data.Labels) *data.Frame {
+	times := []time.Time{}
+	values := []*float64{}
+	anomalies := []bool{}
+	for _, s := range scores {
+		times = append(times, s.ts)
+		values = append(values, s.score)
+		anomalies = append(anomalies, s.anomaly)
+	}
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, times),
+		data.NewField("Score", labels, values),
+		data.NewField("Anomaly", labels, anomalies),
+	)
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestZScoreAnomaly(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 12, func(hour int) float64 { return float64(10 + hour%2) })
+	series[10].Value = 20
+	scores, err := scoreAnomalies(&series, "zscore", 10, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scores[:10] {
+		if s.score != nil || s.anomaly {
+			t.Errorf("sample %d is scored without a full window", i)
+		}
+	}
+	// The window has the mean 10.5 and the standard deviation 0.5.
+	if s := scores[10]; s.score == nil || math.Abs(*s.score-19) > 1e-9 || !s.anomaly {
+		t.Errorf("the outlier has the score %v; expected an anomaly with 19", s.score)
+	}
+}
+
+func TestZScoreLargeValues(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// The spread is lost in running sums of the squares of values this large.
+	series := hourlySeries(start, 40, func(hour int) float64 { return 1e9 + float64(hour%2) })
+	scores, err := scoreAnomalies(&series, "zscore", 10, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scores[10:] {
+		if s.score == nil || math.Abs(math.Abs(*s.score)-1) > 1e-6 || s.anomaly {
+			t.Errorf("sample %d has the score %v; expected 1 or -1", i+10, s.score)
+		}
+	}
+}
+
+func TestStuckSensorAnomaly(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 12, func(hour int) float64 { return 5 })
+	series[11].Value = 5.1
+	scores, err := scoreAnomalies(&series, "zscore", 10, 0, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := scores[10]; s.score != nil || s.anomaly {
+		t.Errorf("a value equal to the stuck window is flagged: %+v", s)
+	}
+	if s := scores[11]; s.score != nil || !s.anomaly {
+		t.Errorf("a value that differs from the stuck window is not flagged: %+v", s)
+	}
+}
+
+func TestSeasonalMadAnomaly(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	daily := func(hour int) float64 { return float64(hour%24) + 0.1*float64(hour/24) }
+	series := hourlySeries(start, 5*24, daily)
+	series[4*24+12].Value = 100
+	scores, err := scoreAnomalies(&series, "mad", 4, 0, "daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, s := range scores {
+		switch {
+		case i < 3*24:
+			if s.score != nil || s.anomaly {
+				t.Errorf("sample %d is scored with less than three seasons", i)
+			}
+		case i == 4*24+12:
+			if !s.anomaly {
+				t.Errorf("the outlier is not flagged: %+v", s)
+			}
+		default:
+			// The daily cycle itself is not an anomaly.
+			if s.anomaly {
+				t.Errorf("sample %d is flagged: %v", i, *s.score)
+			}
+		}
+	}
+}
+
+func TestSeasonalMadStuckSensor(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 4*24, func(hour int) float64 { return 7 })
+	series[3*24+5].Value = 8
+	scores, err := scoreAnomalies(&series, "mad", 3, 0, "daily")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := scores[3*24+4]; s.score != nil || s.anomaly {
+		t.Errorf("a value equal to the stuck baseline is flagged: %+v", s)
+	}
+	if s := scores[3*24+5]; s.score != nil || !s.anomaly {
+		t.Errorf("a value that differs from the stuck baseline is not flagged: %+v", s)
+	}
+}
+
+func TestAnomalyErrors(t *testing.T) {
+	series := hourlySeries(time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), 3, func(hour int) float64 { return 0 })
+	if _, err := scoreAnomalies(&series, "iforest", 0, 0, ""); err == nil {
+		t.Error("an unknown method should fail")
+	}
+	if _, err := scoreAnomalies(&series, "mad", 0, 0, "yearly"); err == nil {
+		t.Error("an unknown seasonality should fail")
+	}
+}
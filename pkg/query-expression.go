@@ -0,0 +1,367 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// exprNode is a node in the parsed expression tree, evaluated once per common timestamp.
+type exprNode interface {
+	eval(values map[string]float64) float64
+}
+
+type constantNode float64
+
+type aliasNode string
+
+type unaryMinusNode struct {
+	operand exprNode
+}
+
+type binaryNode struct {
+	operator byte
+	left     exprNode
+	right    exprNode
+}
+
+type functionNode struct {
+	name string
+	args []exprNode
+}
+
+func (n constantNode) eval(_ map[string]float64) float64 {
+	return float64(n)
+}
+
+func (n aliasNode) eval(values map[string]float64) float64 {
+	return values[string(n)]
+}
+
+func (n unaryMinusNode) eval(values map[string]float64) float64 {
+	return -n.operand.eval(values)
+}
+
+func (n binaryNode) eval(values map[string]float64) float64 {
+	left := n.left.eval(values)
+	right := n.right.eval(values)
+	switch n.operator {
+	case '+':
+		return left + right
+	case '-':
+		return left - right
+	case '*':
+		return left * right
+	default:
+		return left / right
+	}
+}
+
+func (n functionNode) eval(values map[string]float64) float64 {
+	result := n.args[0].eval(values)
+	switch n.name {
+	case "abs":
+		return math.Abs(result)
+	case "min":
+		for _, arg := range n.args[1:] {
+			result = math.Min(result, arg.eval(values))
+		}
+	case "max":
+		for _, arg := range n.args[1:] {
+			result = math.Max(result, arg.eval(values))
+		}
+	}
+	return result
+}
+
+// exprParser is a recursive descent parser for;
+//
+//	expr    := term (('+' | '-') term)*
+//	term    := unary (('*' | '/') unary)*
+//	unary   := '-' unary | primary
+//	primary := number | alias | function '(' expr (',' expr)* ')' | '(' expr ')'
+//
+// The numbers may be in scientific notation, e.g. 1e3.
+type exprParser struct {
+	input   string
+	pos     int
+	aliases map[string]bool
+}
+
+func parseExpression(input string) (exprNode, map[string]bool, error) {
+	p := &exprParser{input: input, aliases: map[string]bool{}}
+	node, err := p.parseExpr()
+	if err != nil {
+		return nil, nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, nil, fmt.Errorf("unexpected '%c' at position %d", p.input[p.pos], p.pos)
+	}
+	return node, p.aliases, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+func (p *exprParser) peek() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+func (p *exprParser) parseExpr() (exprNode, error) {
+	left, err := p.parseTerm()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '+' || op == '-'; op = p.peek() {
+		p.pos++
+		right, err := p.parseTerm()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseTerm() (exprNode, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for op := p.peek(); op == '*' || op == '/'; op = p.peek() {
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = binaryNode{operator: op, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.peek() == '-' {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return unaryMinusNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	c := p.peek()
+	switch {
+	case c == 0:
+		return nil, fmt.Errorf("unexpected end of expression")
+	case c == '(':
+		p.pos++
+		node, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ')' {
+			return nil, fmt.Errorf("missing ')' at position %d", p.pos)
+		}
+		p.pos++
+		return node, nil
+	case c == '.' || unicode.IsDigit(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		p.skipExponent()
+		value, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number '%s'", p.input[start:p.pos])
+		}
+		return constantNode(value), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		name := p.input[start:p.pos]
+		if p.peek() == '(' {
+			return p.parseFunction(name)
+		}
+		p.aliases[name] = true
+		return aliasNode(name), nil
+	}
+	return nil, fmt.Errorf("unexpected '%c' at position %d", c, p.pos)
+}
+
+// skipExponent skips the exponent of a number in scientific notation, such as the "e-3" of "1.5e-3".
+func (p *exprParser) skipExponent() {
+	end := p.pos
+	if end >= len(p.input) || (p.input[end] != 'e' && p.input[end] != 'E') {
+		return
+	}
+	end++
+	if end < len(p.input) && (p.input[end] == '+' || p.input[end] == '-') {
+		end++
+	}
+	if end >= len(p.input) || !unicode.IsDigit(rune(p.input[end])) {
+		return
+	}
+	for end < len(p.input) && unicode.IsDigit(rune(p.input[end])) {
+		end++
+	}
+	p.pos = end
+}
+
+func (p *exprParser) parseFunction(name string) (exprNode, error) {
+	if name != "min" && name != "max" && name != "abs" {
+		return nil, fmt.Errorf("unknown function '%s'", name)
+	}
+	p.pos++ // the '('
+	var args []exprNode
+	for {
+		arg, err := p.parseExpr()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+		if p.peek() != ',' {
+			break
+		}
+		p.pos++
+	}
+	if p.peek() != ')' {
+		return nil, fmt.Errorf("missing ')' in call to %s()", name)
+	}
+	p.pos++
+	if name == "abs" && len(args) != 1 {
+		return nil, fmt.Errorf("abs() takes exactly one argument")
+	}
+	return functionNode{name: name, args: args}, nil
+}
+
+// executeExpressionQuery queries each of the referenced datapoints, and evaluates the expression on the
+// timestamps that all of them have in common. As in executeRollupQuery, the buckets of a time model are
+// already aligned, while the samples are first brought onto a grid of the longest poll interval, since the
+// datapoints are rarely polled at the same instant. The refs must therefore either all be aggregated with the
+// same time model, or none of them.
+func (sds *SensetifDatasource) executeExpressionQuery(ctx context.Context, orgId int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) (*[]model.TsPair, error) {
+	expression, aliases, err := parseExpression(strings.TrimSpace(query.Expression))
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse expression: %w", model.ErrBadRequest, err)
+	}
+	timeModel := ""
+	bucketed := 0
+	for alias := range aliases {
+		ref, ok := query.Refs[alias]
+		if !ok {
+			return nil, fmt.Errorf("%w: expression refers to undefined alias '%s'", model.ErrBadRequest, alias)
+		}
+		aggregation := strings.TrimSpace(ref.Aggregation)
+		if ref.TimeModel == "" || aggregation == "" || aggregation == "sample" {
+			continue
+		}
+		if bucketed > 0 && ref.TimeModel != timeModel {
+			return nil, fmt.Errorf("%w: expression mixes the time models %s and %s", model.ErrBadRequest, timeModel, ref.TimeModel)
+		}
+		timeModel = ref.TimeModel
+		bucketed++
+	}
+	if bucketed > 0 && bucketed < len(aliases) {
+		return nil, fmt.Errorf("%w: expression mixes series with and without the time model %s", model.ErrBadRequest, timeModel)
+	}
+
+	series := make(map[string]*[]model.TsPair)
+	pollIntervals := make(map[string]time.Duration)
+	step := time.Minute
+	if maxValues > 0 {
+		step = max(step, to.Sub(from)/time.Duration(maxValues))
+	}
+	for alias := range aliases {
+		ref := query.Refs[alias]
+		// All samples, or all the buckets, since they are sampled on the grid below.
+		timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, ref, from, to, 0)
+		if err != nil {
+			return nil, fmt.Errorf("query %s: %w", alias, err)
+		}
+		series[alias] = timeseries
+		if bucketed == 0 {
+			datapoint, err := sds.cassandraClient.GetDatapoint(ctx, orgId, ref.Project, ref.Subsystem, ref.Datapoint)
+			if err != nil {
+				return nil, fmt.Errorf("find datapoint %s: %w", alias, err)
+			}
+			pollIntervals[alias] = datapoint.Interval.Duration()
+			step = max(step, pollIntervals[alias])
+		}
+	}
+	if bucketed == 0 {
+		// The grid is aligned on the wall clock of the project of the first alias, like the buckets of a time
+		// model.
+		first := ""
+		for alias := range aliases {
+			if first == "" || alias < first {
+				first = alias
+			}
+		}
+		project, err := sds.cassandraClient.GetProject(ctx, orgId, query.Refs[first].Project)
+		if err != nil {
+			return nil, fmt.Errorf("find project %s: %w", query.Refs[first].Project, err)
+		}
+		start := client.AlignDuration(from, client.CreateLocation(project.Timezone), step)
+		for alias, timeseries := range series {
+			series[alias] = sampleOnGrid(timeseries, pollIntervals[alias], start, to, step)
+		}
+	}
+
+	return evaluateExpression(expression, series), nil
+}
+
+// evaluateExpression evaluates the expression on the timestamps that all the series have in common. The
+// timestamps where the result isn't a finite number, e.g. after a division by zero, are left out.
+func evaluateExpression(expression exprNode, series map[string]*[]model.TsPair) *[]model.TsPair {
+	type row struct {
+		ts     time.Time
+		values map[string]float64
+	}
+	var common map[int64]row
+	for alias, timeseries := range series {
+		next := make(map[int64]row)
+		for _, pair := range *timeseries {
+			key := pair.TS.UnixNano()
+			if common == nil {
+				next[key] = row{ts: pair.TS, values: map[string]float64{alias: pair.Value}}
+			} else if r, found := common[key]; found {
+				r.values[alias] = pair.Value
+				next[key] = r
+			}
+		}
+		common = next
+	}
+
+	result := make([]model.TsPair, 0, len(common))
+	for _, r := range common {
+		value := expression.eval(r.values)
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			result = append(result, model.TsPair{TS: r.ts, Value: value})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TS.Before(result[j].TS)
+	})
+	return &result
+}
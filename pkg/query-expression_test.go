@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func TestParseExpression(t *testing.T) {
+	values := map[string]float64{"a": 2, "b": 3, "heat_out": 10}
+	cases := map[string]float64{
+		"1 + 2 * 3":           7,
+		"(1 + 2) * 3":         9,
+		"8 - 4 - 2":           2,
+		"8 / 4 / 2":           1,
+		"-a * b":              -6,
+		"- -a":                2,
+		"a - -b":              5,
+		"heat_out / a + b":    8,
+		"min(a, b, 1) + 1":    2,
+		"max(a, -b)":          2,
+		"abs(a - b)":          1,
+		"1e3 + 2.5E-1":        1000.25,
+		"1.5e+2":              150,
+		".5 * a":              1,
+		"\ta *\n b\r\n":       6,
+		"2*a*b-a/b*3":         10,
+		"max(min(a,b),1)*2e0": 4,
+	}
+	for input, expected := range cases {
+		node, _, err := parseExpression(input)
+		if err != nil {
+			t.Errorf("parseExpression(%q): %v", input, err)
+			continue
+		}
+		if value := node.eval(values); math.Abs(value-expected) > 1e-9 {
+			t.Errorf("%q = %v; expected %v", input, value, expected)
+		}
+	}
+}
+
+func TestParseExpressionAliases(t *testing.T) {
+	_, aliases, err := parseExpression("heat_out / (power_in + e2) * 1e2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 3 || !aliases["heat_out"] || !aliases["power_in"] || !aliases["e2"] {
+		t.Errorf("parseExpression() found the aliases %v", aliases)
+	}
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, input := range []string{"", "1 +", "(a", "a b", "sqrt(a)", "abs(a, b)", "min(a,", "1e", "a $ b", "1..2"} {
+		if _, _, err := parseExpression(input); err == nil {
+			t.Errorf("parseExpression(%q) should fail", input)
+		}
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	a := hourlySeries(start, 4, func(hour int) float64 { return float64(hour + 1) })
+	b := hourlySeries(start, 4, func(hour int) float64 { return []float64{1, 0, 2, 4}[hour] })
+	// The sample of b at 3h is missing, so there is nothing to evaluate there.
+	b = append(b[:3], model.TsPair{TS: start.Add(30 * time.Hour), Value: 1})
+	node, _, err := parseExpression("a / b")
+	if err != nil {
+		t.Fatal(err)
+	}
+	result := *evaluateExpression(node, map[string]*[]model.TsPair{"a": &a, "b": &b})
+	// The division by zero at 1h is left out.
+	expected := []model.TsPair{{TS: start, Value: 1}, {TS: start.Add(2 * time.Hour), Value: 1.5}}
+	if len(result) != len(expected) {
+		t.Fatalf("evaluateExpression() = %v; expected %v", result, expected)
+	}
+	for i := range expected {
+		if !result[i].TS.Equal(expected[i].TS) || result[i].Value != expected[i].Value {
+			t.Errorf("evaluateExpression()[%d] = %v; expected %v", i, result[i], expected[i])
+		}
+	}
+}
@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Maximum number of forecasted samples, whatever the horizon and the spacing of the history is.
+const maxForecastLength = 2000
+
+// z-value of the 95% prediction interval.
+const forecastZ = 1.96
+
+type forecastPoint struct {
+	ts    time.Time
+	value float64
+	lower float64
+	upper float64
+}
+
+// forecast fits the history and projects it until horizon past the end of the time range;
+//
+//	"linear"      - least squares linear trend
+//	"holtwinters" - additive Holt-Winters, with "daily" or "weekly" seasonality
+//
+// The forecast has the same spacing as the history, which is typically the buckets of the time model.
+func forecast(history *[]model.TsPair, method string, seasonality string, to time.Time, horizon time.Duration) ([]forecastPoint, error) {
+	series := make([]model.TsPair, 0, len(*history))
+	for _, tsPair := range *history {
+		if !math.IsNaN(tsPair.Value) {
+			series = append(series, tsPair)
+		}
+	}
+	slices.SortFunc(series, func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	})
+	if len(series) < 2 {
+		return nil, fmt.Errorf("at least 2 samples are needed for a forecast, got %d", len(series))
+	}
+	step := client.MedianSpacing(series)
+	if step <= 0 {
+		return nil, fmt.Errorf("the samples have no spacing in time")
+	}
+	last := series[len(series)-1].TS
+	steps := int(to.Add(horizon).Sub(last) / step)
+	if steps < 1 {
+		return []forecastPoint{}, nil
+	}
+	steps = min(steps, maxForecastLength)
+
+	switch method {
+	case "linear":
+		return linearForecast(series, step, steps), nil
+	case "holtwinters":
+		var period time.Duration
+		switch seasonality {
+		case "daily":
+			period = 24 * time.Hour
+		case "weekly":
+			period = 7 * 24 * time.Hour
+		default:
+			return nil, fmt.Errorf("unknown seasonality: %s", seasonality)
+		}
+		return holtWintersForecast(series, step, steps, period)
+	}
+	return nil, fmt.Errorf("unknown forecast method: %s", method)
+}
+
+// linearForecast uses the prediction interval of ordinary least squares, which widens with the distance
+// from the center of the history.
+func linearForecast(series []model.TsPair, step time.Duration, steps int) []forecastPoint {
+	origin := series[0].TS
+	n := float64(len(series))
+	meanX, meanY := 0.0, 0.0
+	for _, tsPair := range series {
+		meanX = meanX + tsPair.TS.Sub(origin).Hours()
+		meanY = meanY + tsPair.Value
+	}
+	meanX = meanX / n
+	meanY = meanY / n
+	sxx, sxy := 0.0, 0.0
+	for _, tsPair := range series {
+		dx := tsPair.TS.Sub(origin).Hours() - meanX
+		sxx = sxx + dx*dx
+		sxy = sxy + dx*(tsPair.Value-meanY)
+	}
+	slope := 0.0
+	if sxx > 0 {
+		slope = sxy / sxx
+	}
+	intercept := meanY - slope*meanX
+	sse := 0.0
+	for _, tsPair := range series {
+		residual := tsPair.Value - (intercept + slope*tsPair.TS.Sub(origin).Hours())
+		sse = sse + residual*residual
+	}
+	// Two samples are fitted exactly, which leaves nothing to estimate the spread from.
+	sigma := math.NaN()
+	if n > 2 {
+		sigma = math.Sqrt(sse / (n - 2))
+	}
+
+	last := series[len(series)-1].TS
+	result := make([]forecastPoint, 0, steps)
+	for h := 1; h <= steps; h++ {
+		ts := last.Add(time.Duration(h) * step)
+		x := ts.Sub(origin).Hours()
+		value := intercept + slope*x
+		spread := sigma * math.Sqrt(1+1/n)
+		if sxx > 0 {
+			spread = sigma * math.Sqrt(1+1/n+(x-meanX)*(x-meanX)/sxx)
+		}
+		result = append(result, forecastPoint{ts: ts, value: value, lower: value - forecastZ*spread, upper: value + forecastZ*spread})
+	}
+	return result
+}
+
+type holtWintersFit struct {
+	alpha, beta, gamma float64
+	level, trend       float64
+	seasonals          []float64 // indexed by the position in the season of the next sample
+	sse                float64
+}
+
+// holtWintersForecast resamples the history onto a regular grid, since the additive Holt-Winters model
+// needs a fixed number of samples per season, and picks the smoothing parameters with the least squared
+// one-step error from a coarse grid.
+func holtWintersForecast(series []model.TsPair, step time.Duration, steps int, period time.Duration) ([]forecastPoint, error) {
+	seasonLength := int(period / step)
+	if seasonLength < 2 {
+		return nil, fmt.Errorf("the samples are too far apart for a %v season", period)
+	}
+	grid := resampleLinear(series, step)
+	if len(grid) < 2*seasonLength {
+		return nil, fmt.Errorf("at least two seasons of history are needed, got %d of %d samples", len(grid), 2*seasonLength)
+	}
+
+	var best *holtWintersFit
+	for _, alpha := range []float64{0.1, 0.2, 0.3, 0.5, 0.7, 0.9} {
+		for _, beta := range []float64{0.0, 0.01, 0.05, 0.1, 0.2} {
+			for _, gamma := range []float64{0.05, 0.1, 0.2, 0.3, 0.5} {
+				fit := fitHoltWinters(grid, seasonLength, alpha, beta, gamma)
+				if best == nil || fit.sse < best.sse {
+					best = fit
+				}
+			}
+		}
+	}
+
+	fitted := len(grid) - seasonLength
+	sigma := math.Sqrt(best.sse / float64(fitted))
+	last := series[len(series)-1].TS
+	result := make([]forecastPoint, 0, steps)
+	variance := 0.0
+	for h := 1; h <= steps; h++ {
+		value := best.level + float64(h)*best.trend + best.seasonals[(h-1)%seasonLength]
+		// Variance of the h-step ahead error of the additive model.
+		if h > 1 {
+			j := float64(h - 1)
+			c := best.alpha * (1 + j*best.beta)
+			if (h-1)%seasonLength == 0 {
+				c = c + best.gamma*(1-best.alpha)
+			}
+			variance = variance + c*c
+		}
+		spread := sigma * math.Sqrt(1+variance)
+		ts := last.Add(time.Duration(h) * step)
+		result = append(result, forecastPoint{ts: ts, value: value, lower: value - forecastZ*spread, upper: value + forecastZ*spread})
+	}
+	return result, nil
+}
+
+func fitHoltWinters(values []float64, seasonLength int, alpha float64, beta float64, gamma float64) *holtWintersFit {
+	// Initial level and trend from the first two seasons, and the seasonal components from the first.
+	first, second := 0.0, 0.0
+	for i := 0; i < seasonLength; i++ {
+		first = first + values[i]
+		second = second + values[seasonLength+i]
+	}
+	first = first / float64(seasonLength)
+	second = second / float64(seasonLength)
+	level := first
+	trend := (second - first) / float64(seasonLength)
+	seasonals := make([]float64, seasonLength)
+	for i := 0; i < seasonLength; i++ {
+		seasonals[i] = values[i] - first
+	}
+
+	sse := 0.0
+	for i := seasonLength; i < len(values); i++ {
+		season := i % seasonLength
+		predicted := level + trend + seasonals[season]
+		residual := values[i] - predicted
+		sse = sse + residual*residual
+		previousLevel := level
+		level = alpha*(values[i]-seasonals[season]) + (1-alpha)*(level+trend)
+		trend = beta*(level-previousLevel) + (1-beta)*trend
+		seasonals[season] = gamma*(values[i]-level) + (1-gamma)*seasonals[season]
+	}
+	// Rotate, so that index 0 is the season of the first forecasted sample.
+	next := len(values) % seasonLength
+	rotated := append(slices.Clone(seasonals[next:]), seasonals[:next]...)
+	return &holtWintersFit{alpha: alpha, beta: beta, gamma: gamma, level: level, trend: trend, seasonals: rotated, sse: sse}
+}
+
+// resampleLinear returns the values at every step from the first sample, ending at the last sample,
+// interpolated between the samples on each side.
+func resampleLinear(series []model.TsPair, step time.Duration) []float64 {
+	first := series[0].TS
+	last := series[len(series)-1].TS
+	count := int(last.Sub(first)/step) + 1
+	result := make([]float64, 0, count)
+	index := 0
+	for k := 0; k < count; k++ {
+		ts := first.Add(time.Duration(k) * step)
+		for index < len(series)-2 && !series[index+1].TS.After(ts) {
+			index++
+		}
+		previous := series[index]
+		next := series[index+1]
+		if !next.TS.After(ts) {
+			result = append(result, next.Value)
+			continue
+		}
+		fraction := float64(ts.Sub(previous.TS)) / float64(next.TS.Sub(previous.TS))
+		result = append(result, previous.Value+fraction*(next.Value-previous.Value))
+	}
+	return result
+}
+
+// parseHorizon accepts Go durations, such as "36h", and whole days and weeks, such as "30d" and "2w".
+func parseHorizon(horizon string) (time.Duration, error) {
+	horizon = strings.TrimSpace(horizon)
+	if horizon == "" {
+		return 0, fmt.Errorf("missing forecast horizon")
+	}
+	if days, found := strings.CutSuffix(horizon, "d"); found {
+		if n, err := strconv.Atoi(days); err == nil && n > 0 {
+			return time.Duration(n) * 24 * time.Hour, nil
+		}
+	} else if weeks, found := strings.CutSuffix(horizon, "w"); found {
+		if n, err := strconv.Atoi(weeks); err == nil && n > 0 {
+			return time.Duration(n) * 7 * 24 * time.Hour, nil
+		}
+	} else if duration, err := time.ParseDuration(horizon); err == nil && duration > 0 {
+		return duration, nil
+	}
+	return 0, fmt.Errorf("invalid forecast horizon: %s", horizon)
+}
+
+func formatForecastQuery(queryName string, points []forecastPoint, labels data.Labels) *data.Frame {
+	times := []time.Time{}
+	values := []float64{}
+	lowers := []float64{}
+	uppers := []float64{}
+	for _, p := range points {
+		times = append(times, p.ts)
+		values = append(values, p.value)
+		lowers = append(lowers, p.lower)
+		uppers = append(uppers, p.upper)
+	}
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, times),
+		data.NewField("Forecast", labels, values),
+		data.NewField("Lower", labels, lowers),
+		data.NewField("Upper", labels, uppers),
+	)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func hourlySeries(start time.Time, count int, value func(hour int) float64) []model.TsPair {
+	series := make([]model.TsPair, 0, count)
+	for hour := 0; hour < count; hour++ {
+		series = append(series, model.TsPair{TS: start.Add(time.Duration(hour) * time.Hour), Value: value(hour)})
+	}
+	return series
+}
+
+func TestLinearForecast(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 10, func(hour int) float64 { return 1 + 2*float64(hour) })
+	points := linearForecast(series, time.Hour, 3)
+	if len(points) != 3 {
+		t.Fatalf("linearForecast() returned %d points; expected 3", len(points))
+	}
+	for i, p := range points {
+		hour := 10 + i
+		if !p.ts.Equal(start.Add(time.Duration(hour) * time.Hour)) {
+			t.Errorf("point %d at %v", i, p.ts)
+		}
+		if expected := 1 + 2*float64(hour); math.Abs(p.value-expected) > 1e-9 {
+			t.Errorf("point %d = %v; expected %v", i, p.value, expected)
+		}
+		// A perfect fit has no spread.
+		if math.Abs(p.upper-p.lower) > 1e-9 {
+			t.Errorf("point %d has the interval %v..%v; expected none", i, p.lower, p.upper)
+		}
+	}
+}
+
+func TestLinearForecastIntervalWidens(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 20, func(hour int) float64 { return float64(hour) + float64(hour%2) })
+	points := linearForecast(series, time.Hour, 5)
+	for i := 1; i < len(points); i++ {
+		previous := points[i-1].upper - points[i-1].lower
+		current := points[i].upper - points[i].lower
+		if !(current > previous) {
+			t.Errorf("the interval of point %d is %v, and not wider than %v", i, current, previous)
+		}
+	}
+}
+
+func TestLinearForecastTwoSamples(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 2, func(hour int) float64 { return 5 + float64(hour) })
+	points := linearForecast(series, time.Hour, 2)
+	if len(points) != 2 {
+		t.Fatalf("linearForecast() returned %d points; expected 2", len(points))
+	}
+	for i, p := range points {
+		if expected := 7 + float64(i); math.Abs(p.value-expected) > 1e-9 {
+			t.Errorf("point %d = %v; expected %v", i, p.value, expected)
+		}
+		if !math.IsNaN(p.lower) || !math.IsNaN(p.upper) {
+			t.Errorf("point %d has the interval %v..%v; expected none from two samples", i, p.lower, p.upper)
+		}
+	}
+}
+
+func TestForecastTwoSamples(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := hourlySeries(start, 3, func(hour int) float64 { return float64(hour) })
+	history[1].Value = math.NaN()
+	points, err := forecast(&history, "linear", "", start.Add(2*time.Hour), 2*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 1 || math.Abs(points[0].value-4) > 1e-9 || !math.IsNaN(points[0].lower) {
+		t.Errorf("forecast() = %+v; expected 4 at 4h without an interval", points)
+	}
+	history[2].Value = math.NaN()
+	if _, err := forecast(&history, "linear", "", start.Add(2*time.Hour), time.Hour); err == nil {
+		t.Error("forecast() of one sample should fail")
+	}
+}
+
+func TestForecastHoltWinters(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	daily := func(hour int) float64 { return 10 + 5*math.Sin(2*math.Pi*float64(hour%24)/24) }
+	history := hourlySeries(start, 3*24, daily)
+	to := history[len(history)-1].TS
+	points, err := forecast(&history, "holtwinters", "daily", to, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(points) != 24 {
+		t.Fatalf("forecast() returned %d points; expected 24", len(points))
+	}
+	for i, p := range points {
+		if expected := daily(3*24 + i); math.Abs(p.value-expected) > 1e-6 {
+			t.Errorf("point %d = %v; expected %v", i, p.value, expected)
+		}
+	}
+}
+
+func TestForecastErrors(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	history := hourlySeries(start, 24, func(hour int) float64 { return float64(hour) })
+	to := history[len(history)-1].TS
+	if _, err := forecast(&history, "arima", "", to, time.Hour); err == nil {
+		t.Error("an unknown method should fail")
+	}
+	if _, err := forecast(&history, "holtwinters", "yearly", to, time.Hour); err == nil {
+		t.Error("an unknown seasonality should fail")
+	}
+	if _, err := forecast(&history, "holtwinters", "daily", to, time.Hour); err == nil {
+		t.Error("less than two seasons of history should fail")
+	}
+}
+
+func TestParseHorizon(t *testing.T) {
+	valid := map[string]time.Duration{"36h": 36 * time.Hour, "30d": 30 * 24 * time.Hour, "2w": 14 * 24 * time.Hour, " 90m ": 90 * time.Minute}
+	for horizon, expected := range valid {
+		if duration, err := parseHorizon(horizon); err != nil || duration != expected {
+			t.Errorf("parseHorizon(%q) = %v, %v; expected %v", horizon, duration, err, expected)
+		}
+	}
+	for _, horizon := range []string{"", "0d", "-1w", "1y", "d", "-2h"} {
+		if _, err := parseHorizon(horizon); err == nil {
+			t.Errorf("parseHorizon(%q) should fail", horizon)
+		}
+	}
+}
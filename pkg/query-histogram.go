@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// Upper limit of the number of histogram buckets, to not create huge frames by mistake with a tiny bucket width.
+const maxHistogramBuckets = 1000
+
+const defaultHistogramBuckets = 10
+
+type histogramBucket struct {
+	lower float64
+	upper float64
+	total float64 // number of samples, or hours
+}
+
+// histogramOf distributes the values into buckets of the given width, or into the given number of equally
+// wide buckets between the smallest and the largest value;
+//
+//	"count"    - the number of samples in each bucket
+//	"duration" - the hours spent in each bucket, where each sample lasts until the next one, but no longer
+//	             than one and a half of the expected step, so that gaps in the data are not counted.
+//
+// The buckets include the lower bound, but not the upper bound.
+func histogramOf(timeseries *[]model.TsPair, mode string, bucketWidth float64, bucketCount int, pollInterval time.Duration) ([]histogramBucket, error) {
+	if mode != "count" && mode != "duration" {
+		return nil, fmt.Errorf("unknown histogram: %s", mode)
+	}
+	series := make([]model.TsPair, 0, len(*timeseries))
+	for _, tsPair := range *timeseries {
+		if !math.IsNaN(tsPair.Value) && !math.IsInf(tsPair.Value, 0) {
+			series = append(series, tsPair)
+		}
+	}
+	if len(series) == 0 {
+		return []histogramBucket{}, nil
+	}
+	slices.SortFunc(series, func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	})
+	minimum, maximum := math.Inf(1), math.Inf(-1)
+	for _, tsPair := range series {
+		minimum = math.Min(minimum, tsPair.Value)
+		maximum = math.Max(maximum, tsPair.Value)
+	}
+
+	var lower float64
+	var count int
+	if bucketWidth != 0 {
+		if bucketWidth < 0 || math.IsNaN(bucketWidth) || math.IsInf(bucketWidth, 0) {
+			return nil, fmt.Errorf("invalid bucket width: %g", bucketWidth)
+		}
+		lower = math.Floor(minimum/bucketWidth) * bucketWidth
+		// Counted as a float, since a tiny width overflows an int.
+		buckets := math.Floor((maximum-lower)/bucketWidth) + 1
+		if !(buckets >= 1 && buckets <= maxHistogramBuckets) {
+			return nil, fmt.Errorf("bucket width %g gives more than %d buckets", bucketWidth, maxHistogramBuckets)
+		}
+		count = int(buckets)
+	} else {
+		count = bucketCount
+		if count <= 0 {
+			count = defaultHistogramBuckets
+		}
+		count = min(count, maxHistogramBuckets)
+		lower = minimum
+		bucketWidth = (maximum - minimum) / float64(count)
+		if bucketWidth == 0 {
+			bucketWidth = 1
+		}
+	}
+	buckets := make([]histogramBucket, count)
+	for i := range buckets {
+		buckets[i].lower = lower + float64(i)*bucketWidth
+		buckets[i].upper = lower + float64(i+1)*bucketWidth
+	}
+
+	step := max(pollInterval, client.MedianSpacing(series))
+	for i, tsPair := range series {
+		// The maximum ends up on the upper bound of the last bucket, when the buckets are counted.
+		index := min(int((tsPair.Value-lower)/bucketWidth), count-1)
+		if mode == "count" {
+			buckets[index].total++
+			continue
+		}
+		duration := step
+		if i+1 < len(series) {
+			duration = min(series[i+1].TS.Sub(tsPair.TS), step*3/2)
+		}
+		buckets[index].total = buckets[index].total + duration.Hours()
+	}
+	return buckets, nil
+}
+
+// formatHistogramQuery uses the field names of the Grafana histogram panel for already bucketed data.
+func formatHistogramQuery(queryName string, buckets []histogramBucket, mode string, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	lowers := []float64{}
+	uppers := []float64{}
+	totals := []float64{}
+	for _, b := range buckets {
+		lowers = append(lowers, b.lower)
+		uppers = append(uppers, b.upper)
+		totals = append(totals, b.total)
+	}
+	boundsConfig := &data.FieldConfig{Unit: config.Unit}
+	xMin := data.NewField("xMin", nil, lowers)
+	xMin.Config = boundsConfig
+	xMax := data.NewField("xMax", nil, uppers)
+	xMax.Config = boundsConfig
+	totalConfig := &data.FieldConfig{DisplayNameFromDS: config.DisplayNameFromDS}
+	name := "count"
+	if mode == "duration" {
+		name = "hours"
+		totalConfig.Unit = "h"
+	}
+	total := data.NewField(name, labels, totals)
+	total.Config = totalConfig
+	return data.NewFrame(queryName, xMin, xMax, total)
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+func TestHistogramCount(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 5, func(hour int) float64 { return []float64{0.5, 1.5, 1.7, 2.0, math.NaN()}[hour] })
+	buckets, err := histogramOf(&series, "count", 1, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []histogramBucket{{0, 1, 1}, {1, 2, 2}, {2, 3, 1}}
+	if len(buckets) != len(expected) {
+		t.Fatalf("histogramOf() = %v; expected %v", buckets, expected)
+	}
+	for i := range expected {
+		if buckets[i] != expected[i] {
+			t.Errorf("bucket %d = %v; expected %v", i, buckets[i], expected[i])
+		}
+	}
+}
+
+func TestHistogramDuration(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := []model.TsPair{
+		{TS: start, Value: 0},
+		{TS: start.Add(10 * time.Minute), Value: 0},
+		{TS: start.Add(20 * time.Minute), Value: 1},
+		{TS: start.Add(30 * time.Minute), Value: 1}, // followed by a gap, which counts for 15 minutes
+		{TS: start.Add(90 * time.Minute), Value: 0}, // the last sample counts for one poll interval
+	}
+	buckets, err := histogramOf(&series, "duration", 1, 0, 10*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 2 {
+		t.Fatalf("histogramOf() returned %d buckets; expected 2", len(buckets))
+	}
+	for i, minutes := range []float64{30, 25} {
+		if math.Abs(buckets[i].total-minutes/60) > 1e-9 {
+			t.Errorf("bucket %d has %v hours; expected %v", i, buckets[i].total, minutes/60)
+		}
+	}
+}
+
+func TestHistogramBucketCount(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := hourlySeries(start, 11, func(hour int) float64 { return float64(hour) })
+	buckets, err := histogramOf(&series, "count", 0, 5, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(buckets) != 5 || buckets[0].lower != 0 || buckets[4].upper != 10 || buckets[4].total != 3 {
+		t.Errorf("histogramOf() = %v; expected 5 buckets from 0 to 10, with the maximum in the last", buckets)
+	}
+}
+
+func TestHistogramInvalidBucketWidth(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, scale := range []float64{1, 1e10} {
+		series := hourlySeries(start, 3, func(hour int) float64 { return scale * float64(hour+1) })
+		for _, width := range []float64{1e-300, 1e-3, -1, math.NaN(), math.Inf(1)} {
+			if _, err := histogramOf(&series, "count", width, 0, time.Hour); err == nil {
+				t.Errorf("histogramOf() of values around %g with the bucket width %g should fail", scale, width)
+			}
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// findInventory collects all datapoints of all projects in the organization.
+func (sds *SensetifDatasource) findInventory(ctx context.Context, orgId int64) ([]model.DatapointSettings, error) {
+	inventory := make([]model.DatapointSettings, 0)
+	projects, err := sds.cassandraClient.FindAllProjects(ctx, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("find projects: %w", err)
+	}
+	for _, project := range projects {
+		subsystems, err := sds.cassandraClient.FindAllSubsystems(ctx, orgId, project.Name)
+		if err != nil {
+			return nil, fmt.Errorf("find subsystems of %s: %w", project.Name, err)
+		}
+		for _, subsystem := range subsystems {
+			datapoints, err := sds.cassandraClient.FindAllDatapoints(ctx, orgId, project.Name, subsystem.Name)
+			if err != nil {
+				return nil, fmt.Errorf("find datapoints of %s/%s: %w", project.Name, subsystem.Name, err)
+			}
+			inventory = append(inventory, datapoints...)
+		}
+	}
+	return inventory, nil
+}
+
+func formatSubsystemsQuery(queryName string, subsystems []model.SubsystemSettings) *data.Frame {
+	projects := []string{}
+	names := []string{}
+	titles := []string{}
+	locations := []string{}
+	for _, s := range subsystems {
+		projects = append(projects, s.Project)
+		names = append(names, s.Name)
+		titles = append(titles, s.Title)
+		locations = append(locations, s.Locallocation)
+	}
+	frame := data.NewFrame(queryName,
+		data.NewField("Project", nil, projects),
+		data.NewField("Name", nil, names),
+		data.NewField("Title", nil, titles),
+		data.NewField("Location", nil, locations),
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTable}
+	return frame
+}
+
+func formatDatapointsQuery(queryName string, datapoints []model.DatapointSettings) *data.Frame {
+	projects := []string{}
+	subsystems := []string{}
+	names := []string{}
+	units := []string{}
+	pollIntervals := []string{}
+	sourceTypes := []string{}
+	timeToLives := []string{}
+	for _, d := range datapoints {
+		projects = append(projects, d.Project)
+		subsystems = append(subsystems, d.Subsystem)
+		names = append(names, d.Name)
+		units = append(units, d.Proc.Unit)
+		pollIntervals = append(pollIntervals, string(d.Interval))
+		sourceTypes = append(sourceTypes, string(d.SourceType))
+		timeToLives = append(timeToLives, string(d.TimeToLive))
+	}
+	frame := data.NewFrame(queryName,
+		data.NewField("Project", nil, projects),
+		data.NewField("Subsystem", nil, subsystems),
+		data.NewField("Name", nil, names),
+		data.NewField("Unit", nil, units),
+		data.NewField("Poll Interval", nil, pollIntervals),
+		data.NewField("Source Type", nil, sourceTypes),
+		data.NewField("Time To Live", nil, timeToLives),
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTable}
+	return frame
+}
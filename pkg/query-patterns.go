@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// namePattern matches subsystem and datapoint names against either a glob (e.g. "ahu_*") or an
+// anchored regular expression (e.g. "ahu_[0-9]+"). A plain name always matches itself.
+type namePattern struct {
+	pattern string
+	regex   *regexp.Regexp
+}
+
+func isPattern(name string) bool {
+	return strings.ContainsAny(name, "*?[]+()|^{}\\")
+}
+
+func compilePattern(pattern string) namePattern {
+	np := namePattern{pattern: pattern}
+	if isPattern(pattern) {
+		// A glob like "*" is not a valid regexp, in which case only the glob matching is used.
+		regex, err := regexp.Compile("^(?:" + pattern + ")$")
+		if err == nil {
+			np.regex = regex
+		}
+	}
+	return np
+}
+
+func (np namePattern) matches(name string) bool {
+	if np.pattern == name {
+		return true
+	}
+	if ok, err := path.Match(np.pattern, name); err == nil && ok {
+		return true
+	}
+	return np.regex != nil && np.regex.MatchString(name)
+}
+
+// expandQuery resolves the Project, Subsystem and Datapoint patterns of the query into one QueryRef per
+// matching series. Queries without patterns are returned as-is, without touching Cassandra, and so are those
+// that name an existing series exactly.
+func (sds *SensetifDatasource) expandQuery(ctx context.Context, orgId int64, query model.QueryRef) ([]model.QueryRef, error) {
+	if !isPattern(query.Project) && !isPattern(query.Subsystem) && !isPattern(query.Datapoint) {
+		return []model.QueryRef{query}, nil
+	}
+	// Names like "values[0]" are valid patterns too, so a series with the exact name is preferred.
+	exact, err := sds.cassandraClient.GetDatapoint(ctx, orgId, query.Project, query.Subsystem, query.Datapoint)
+	if err != nil {
+		return nil, fmt.Errorf("find datapoint: %w", err)
+	}
+	if exact.Name != "" {
+		return []model.QueryRef{query}, nil
+	}
+	if !isPattern(query.Project) {
+		return sds.expandProject(ctx, orgId, query)
+	}
+	projects, err := sds.cassandraClient.FindAllProjects(ctx, orgId)
+	if err != nil {
+		return nil, fmt.Errorf("find projects: %w", err)
+	}
+	projectPattern := compilePattern(query.Project)
+	result := make([]model.QueryRef, 0)
+	for _, project := range projects {
+		if projectPattern.matches(project.Name) {
+			projectQuery := query
+			projectQuery.Project = project.Name
+			expanded, err := sds.expandProject(ctx, orgId, projectQuery)
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, expanded...)
+		}
+	}
+	return result, nil
+}
+
+// expandProject resolves the Subsystem and Datapoint patterns within the project. Plain names are looked up
+// too, so that a project without the subsystem or the datapoint is left out rather than failing the query.
+func (sds *SensetifDatasource) expandProject(ctx context.Context, orgId int64, query model.QueryRef) ([]model.QueryRef, error) {
+	subsystemPattern := compilePattern(query.Subsystem)
+	datapointPattern := compilePattern(query.Datapoint)
+
+	var subsystems []string
+	if isPattern(query.Subsystem) {
+		all, err := sds.cassandraClient.FindAllSubsystems(ctx, orgId, query.Project)
+		if err != nil {
+			return nil, fmt.Errorf("find subsystems of %s: %w", query.Project, err)
+		}
+		for _, subsystem := range all {
+			if subsystemPattern.matches(subsystem.Name) {
+				subsystems = append(subsystems, subsystem.Name)
+			}
+		}
+	} else {
+		subsystems = []string{query.Subsystem}
+	}
+
+	result := make([]model.QueryRef, 0)
+	for _, subsystem := range subsystems {
+		datapoints, err := sds.cassandraClient.FindAllDatapoints(ctx, orgId, query.Project, subsystem)
+		if err != nil {
+			return nil, fmt.Errorf("find datapoints of %s/%s: %w", query.Project, subsystem, err)
+		}
+		for _, datapoint := range datapoints {
+			if datapointPattern.matches(datapoint.Name) {
+				expanded := query
+				expanded.Subsystem = subsystem
+				expanded.Datapoint = datapoint.Name
+				result = append(result, expanded)
+			}
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Subsystem == result[j].Subsystem {
+			return result[i].Datapoint < result[j].Datapoint
+		}
+		return result[i].Subsystem < result[j].Subsystem
+	})
+	return result, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+const defaultRankingLimit = 10
+
+type rankingRow struct {
+	rank  int
+	ref   model.QueryRef
+	value float64
+	share float64 // of the total of all the matching series, not only the ranked ones
+}
+
+// executeRankingQuery aggregates each of the matching series over the whole time range, and returns the
+// Limit largest ("top") or smallest ("bottom") of them. Series without samples are left out.
+func (sds *SensetifDatasource) executeRankingQuery(ctx context.Context, orgId int64, query model.QueryRef, from time.Time, to time.Time) ([]rankingRow, error) {
+	if query.Rank != "top" && query.Rank != "bottom" {
+		return nil, fmt.Errorf("%w: unknown rank: %s", model.ErrBadRequest, query.Rank)
+	}
+	limit := query.Limit
+	if limit <= 0 {
+		limit = defaultRankingLimit
+	}
+	queryRefs, err := sds.expandQuery(ctx, orgId, query)
+	if err != nil {
+		return nil, err
+	}
+	aggregation := strings.TrimSpace(query.Aggregation)
+
+	var rows []rankingRow
+	total := 0.0
+	for _, ref := range queryRefs {
+		// All samples, with the transform but without any reduction, so the aggregation covers the time range.
+		raw := model.QueryRef{
+			Project:       ref.Project,
+			Subsystem:     ref.Subsystem,
+			Datapoint:     ref.Datapoint,
+			Transform:     ref.Transform,
+			TransformUnit: ref.TransformUnit,
+			CounterMax:    ref.CounterMax,
+		}
+		timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, raw, from, to, 0)
+		if err != nil {
+			return nil, fmt.Errorf("query %s/%s/%s: %w", ref.Project, ref.Subsystem, ref.Datapoint, err)
+		}
+		value, err := client.Aggregate(aggregation, timeseries)
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(value) {
+			continue
+		}
+		rows = append(rows, rankingRow{ref: ref, value: value})
+		total = total + value
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool {
+		if query.Rank == "top" {
+			return rows[i].value > rows[j].value
+		}
+		return rows[i].value < rows[j].value
+	})
+	if len(rows) > limit {
+		rows = rows[:limit]
+	}
+	for i := range rows {
+		rows[i].rank = i + 1
+		if total != 0 {
+			rows[i].share = rows[i].value / total
+		}
+	}
+	return rows, nil
+}
+
+func formatRankingQuery(queryName string, rows []rankingRow) *data.Frame {
+	ranks := []int64{}
+	projects := []string{}
+	subsystems := []string{}
+	datapoints := []string{}
+	values := []float64{}
+	shares := []float64{}
+	for _, r := range rows {
+		ranks = append(ranks, int64(r.rank))
+		projects = append(projects, r.ref.Project)
+		subsystems = append(subsystems, r.ref.Subsystem)
+		datapoints = append(datapoints, r.ref.Datapoint)
+		values = append(values, r.value)
+		shares = append(shares, r.share)
+	}
+	share := data.NewField("Share", nil, shares)
+	share.Config = &data.FieldConfig{Unit: "percentunit"}
+	frame := data.NewFrame(queryName,
+		data.NewField("Rank", nil, ranks),
+		data.NewField("Project", nil, projects),
+		data.NewField("Subsystem", nil, subsystems),
+		data.NewField("Datapoint", nil, datapoints),
+		data.NewField("Value", nil, values),
+		share,
+	)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeTable}
+	return frame
+}
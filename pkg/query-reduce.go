@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// reduceTimeseries reduces the series to a single number, which is what Grafana alert rules evaluate;
+// "last", "first", "min", "max", "mean", "sum" or "count". The missing (NaN) samples are ignored, and
+// nil is returned if there is nothing to reduce, so that the alert rule sees No Data.
+func reduceTimeseries(timeseries *[]model.TsPair, reduce string) (*float64, error) {
+	var first, last *model.TsPair
+	count := 0
+	sum := 0.0
+	minimum := math.Inf(1)
+	maximum := math.Inf(-1)
+	for i := range *timeseries {
+		tsPair := &(*timeseries)[i]
+		if math.IsNaN(tsPair.Value) {
+			continue
+		}
+		// The series is not always in ascending order, e.g. after reduceDefault().
+		if first == nil || tsPair.TS.Before(first.TS) {
+			first = tsPair
+		}
+		if last == nil || tsPair.TS.After(last.TS) {
+			last = tsPair
+		}
+		count++
+		sum = sum + tsPair.Value
+		minimum = math.Min(minimum, tsPair.Value)
+		maximum = math.Max(maximum, tsPair.Value)
+	}
+
+	var value float64
+	switch reduce {
+	case "count":
+		value = float64(count)
+		return &value, nil
+	case "last", "first", "min", "max", "mean", "sum":
+	default:
+		return nil, fmt.Errorf("unknown reduction: %s", reduce)
+	}
+	if count == 0 {
+		return nil, nil
+	}
+	switch reduce {
+	case "last":
+		value = last.Value
+	case "first":
+		value = first.Value
+	case "min":
+		value = minimum
+	case "max":
+		value = maximum
+	case "mean":
+		value = sum / float64(count)
+	case "sum":
+		value = sum
+	}
+	return &value, nil
+}
+
+// formatReducedQuery returns one frame per series, in the numeric multi format of the Grafana data plane,
+// told apart by the labels.
+func formatReducedQuery(queryName string, value *float64, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	valueField := data.NewField("Value", labels, []*float64{value})
+	valueField.Config = config
+	frame := data.NewFrame(queryName, valueField)
+	frame.Meta = &data.FrameMeta{Type: data.FrameTypeNumericMulti, TypeVersion: data.FrameTypeVersion{0, 1}}
+	return frame
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+)
+
+// executeRollupQuery combines the same datapoint of all the subsystems (or the Subsystem pattern) of the
+// project into one series; "sum", "average", "min" or "max". The series are first brought onto common
+// timestamps. With an aggregation and a time model, the buckets are already aligned. Otherwise the series are
+// sampled on a grid of the longest poll interval, holding each value for up to one and a half of its own poll
+// interval. The series without a value at a timestamp are left out there, so a failing sensor doesn't cause
+// the rollup to go missing.
+//
+// The settings of the first datapoint are returned for the unit of the result.
+func (sds *SensetifDatasource) executeRollupQuery(ctx context.Context, orgId int64, query model.QueryRef, from time.Time, to time.Time, maxValues int) (*[]model.TsPair, model.DatapointSettings, error) {
+	var first model.DatapointSettings
+	switch query.Rollup {
+	case "sum", "average", "min", "max":
+	default:
+		return nil, first, fmt.Errorf("%w: unknown rollup: %s", model.ErrBadRequest, query.Rollup)
+	}
+	if query.Subsystem == "" {
+		query.Subsystem = "*"
+	}
+	queryRefs, err := sds.expandQuery(ctx, orgId, query)
+	if err != nil {
+		return nil, first, err
+	}
+	if len(queryRefs) == 0 {
+		return &[]model.TsPair{}, first, nil
+	}
+
+	var series []*[]model.TsPair
+	var pollIntervals []time.Duration
+	aggregation := strings.TrimSpace(query.Aggregation)
+	bucketed := query.TimeModel != "" && aggregation != "" && aggregation != "sample"
+	if !bucketed && aggregation != "" && aggregation != "sample" {
+		// The series are sampled on the grid, so the aggregation would be silently ignored.
+		return nil, first, fmt.Errorf("%w: the rollup with the aggregation %s needs a time model", model.ErrBadRequest, aggregation)
+	}
+	for i, ref := range queryRefs {
+		datapoint, err := sds.cassandraClient.GetDatapoint(ctx, orgId, ref.Project, ref.Subsystem, ref.Datapoint)
+		if err != nil {
+			return nil, first, fmt.Errorf("find datapoint %s/%s: %w", ref.Subsystem, ref.Datapoint, err)
+		}
+		if i == 0 {
+			first = datapoint
+		}
+		ref.Rollup = ""
+		limit := maxValues
+		if !bucketed {
+			// All samples, since they are sampled on the grid below.
+			ref = model.QueryRef{
+				Project:       ref.Project,
+				Subsystem:     ref.Subsystem,
+				Datapoint:     ref.Datapoint,
+				Transform:     ref.Transform,
+				TransformUnit: ref.TransformUnit,
+				CounterMax:    ref.CounterMax,
+			}
+			limit = 0
+		}
+		timeseries, err := sds.cassandraClient.QueryTimeseries(ctx, orgId, ref, from, to, limit)
+		if err != nil {
+			return nil, first, fmt.Errorf("query %s/%s: %w", ref.Subsystem, ref.Datapoint, err)
+		}
+		series = append(series, timeseries)
+		pollIntervals = append(pollIntervals, datapoint.Interval.Duration())
+	}
+
+	if bucketed {
+		return rollupBuckets(series, query.Rollup), first, nil
+	}
+	step := time.Minute
+	for _, pollInterval := range pollIntervals {
+		step = max(step, pollInterval)
+	}
+	if maxValues > 0 {
+		step = max(step, to.Sub(from)/time.Duration(maxValues))
+	}
+	// The grid is aligned on the wall clock of the project, like the buckets of a time model.
+	project, err := sds.cassandraClient.GetProject(ctx, orgId, query.Project)
+	if err != nil {
+		return nil, first, fmt.Errorf("find project %s: %w", query.Project, err)
+	}
+	start := client.AlignDuration(from, client.CreateLocation(project.Timezone), step)
+	return rollupGrid(series, pollIntervals, query.Rollup, start, to, step), first, nil
+}
+
+// rollupBuckets combines the values with the same timestamp.
+func rollupBuckets(series []*[]model.TsPair, rollup string) *[]model.TsPair {
+	type bucket struct {
+		ts     time.Time
+		values []float64
+	}
+	buckets := make(map[int64]*bucket)
+	for _, timeseries := range series {
+		for _, tsPair := range *timeseries {
+			if math.IsNaN(tsPair.Value) {
+				continue
+			}
+			key := tsPair.TS.UnixNano()
+			if _, found := buckets[key]; !found {
+				buckets[key] = &bucket{ts: tsPair.TS}
+			}
+			buckets[key].values = append(buckets[key].values, tsPair.Value)
+		}
+	}
+	result := make([]model.TsPair, 0, len(buckets))
+	for _, b := range buckets {
+		result = append(result, model.TsPair{TS: b.ts, Value: rollupOf(rollup, b.values)})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].TS.Before(result[j].TS)
+	})
+	return &result
+}
+
+// rollupGrid samples each series on the grid, see sampleOnGrid, and combines the values with the same
+// timestamp.
+func rollupGrid(series []*[]model.TsPair, pollIntervals []time.Duration, rollup string, start time.Time, to time.Time, step time.Duration) *[]model.TsPair {
+	sampled := make([]*[]model.TsPair, len(series))
+	for i, timeseries := range series {
+		sampled[i] = sampleOnGrid(timeseries, pollIntervals[i], start, to, step)
+	}
+	return rollupBuckets(sampled, rollup)
+}
+
+// sampleOnGrid takes the last value at or before every step, unless that value is older than one and a half
+// poll interval. The series must be in chronological order.
+func sampleOnGrid(timeseries *[]model.TsPair, pollInterval time.Duration, start time.Time, to time.Time, step time.Duration) *[]model.TsPair {
+	next := 0 // index of the first sample after the current step
+	var result []model.TsPair
+	for ts := start; !ts.After(to); ts = ts.Add(step) {
+		for next < len(*timeseries) && !(*timeseries)[next].TS.After(ts) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+		held := (*timeseries)[next-1]
+		if math.IsNaN(held.Value) || ts.Sub(held.TS) > max(pollInterval*3/2, step) {
+			continue
+		}
+		result = append(result, model.TsPair{TS: ts, Value: held.Value})
+	}
+	return &result
+}
+
+func rollupOf(rollup string, values []float64) float64 {
+	switch rollup {
+	case "min":
+		return slices.Min(values)
+	case "max":
+		return slices.Max(values)
+	}
+	sum := 0.0
+	for _, value := range values {
+		sum = sum + value
+	}
+	if rollup == "average" {
+		return sum / float64(len(values))
+	}
+	return sum
+}
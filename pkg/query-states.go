@@ -0,0 +1,177 @@
+package main
+
+import (
+	"math"
+	"slices"
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+type stateInterval struct {
+	start time.Time
+	end   time.Time
+	value float64
+}
+
+type stateTotals struct {
+	day          time.Time
+	runningHours float64
+	starts       int
+}
+
+// statesOf collapses the consecutive samples with the same value into intervals. An interval lasts until the
+// next sample with another value, but a gap of more than one and a half poll interval ends the interval one
+// poll interval after its last sample, since the state during the gap is unknown. Same for the last interval,
+// which ends no later than the end of the time range.
+func statesOf(timeseries *[]model.TsPair, pollInterval time.Duration, to time.Time) []stateInterval {
+	series := make([]model.TsPair, 0, len(*timeseries))
+	for _, tsPair := range *timeseries {
+		if !math.IsNaN(tsPair.Value) {
+			series = append(series, tsPair)
+		}
+	}
+	slices.SortFunc(series, func(a, b model.TsPair) int {
+		return a.TS.Compare(b.TS)
+	})
+	step := pollInterval
+	if step <= 0 {
+		step = client.MedianSpacing(series)
+	}
+
+	var result []stateInterval
+	for i, tsPair := range series {
+		if i > 0 && tsPair.TS.Sub(series[i-1].TS) > step*3/2 {
+			result[len(result)-1].end = series[i-1].TS.Add(step)
+			result = append(result, stateInterval{start: tsPair.TS, value: tsPair.Value})
+		} else if i == 0 || tsPair.Value != result[len(result)-1].value {
+			if i > 0 {
+				result[len(result)-1].end = tsPair.TS
+			}
+			result = append(result, stateInterval{start: tsPair.TS, value: tsPair.Value})
+		}
+	}
+	if len(result) > 0 {
+		last := series[len(series)-1].TS.Add(step)
+		if last.After(to) {
+			last = to
+		}
+		result[len(result)-1].end = last
+	}
+	return result
+}
+
+// stateTotalsOf sums the time in a non-zero state, e.g. running, for each day in the location, and counts the
+// number of starts, i.e. the changes from zero to non-zero.
+func stateTotalsOf(intervals []stateInterval, location *time.Location) []stateTotals {
+	if len(intervals) == 0 {
+		return []stateTotals{}
+	}
+	firstDay := startOfDay(intervals[0].start, location)
+	var result []stateTotals
+	for day := firstDay; day.Before(intervals[len(intervals)-1].end); day = day.AddDate(0, 0, 1) {
+		result = append(result, stateTotals{day: day})
+	}
+	dayIndex := func(tm time.Time) int {
+		// Days are counted on the calendar, since not all days are 24 hours.
+		index := 0
+		for index+1 < len(result) && !tm.Before(result[index+1].day) {
+			index++
+		}
+		return index
+	}
+	for i, interval := range intervals {
+		if interval.value == 0 {
+			continue
+		}
+		if i > 0 && intervals[i-1].value == 0 && intervals[i-1].end.Equal(interval.start) {
+			result[dayIndex(interval.start)].starts++
+		}
+		// Split the interval at midnight.
+		for index := dayIndex(interval.start); index < len(result) && interval.end.After(result[index].day); index++ {
+			start := interval.start
+			if start.Before(result[index].day) {
+				start = result[index].day
+			}
+			end := interval.end
+			if dayEnd := result[index].day.AddDate(0, 0, 1); end.After(dayEnd) {
+				end = dayEnd
+			}
+			result[index].runningHours = result[index].runningHours + end.Sub(start).Hours()
+		}
+	}
+	return result
+}
+
+func startOfDay(tm time.Time, location *time.Location) time.Time {
+	localTime := tm.In(location)
+	return time.Date(localTime.Year(), localTime.Month(), localTime.Day(), 0, 0, 0, 0, location)
+}
+
+// formatStatesQuery returns the intervals with the start as the time field and the state as the value, which
+// the state timeline panel draws. The end and the duration are hidden from the panel, but shown in tables.
+// A row without a state follows each interval that doesn't end where the next one starts, and the last one,
+// so that the panel doesn't draw the state through the gaps.
+func formatStatesQuery(queryName string, intervals []stateInterval, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	starts := []time.Time{}
+	ends := []*time.Time{}
+	durations := []*float64{}
+	values := []*float64{}
+	add := func(start time.Time, end *time.Time, value *float64) {
+		starts = append(starts, start)
+		ends = append(ends, end)
+		values = append(values, value)
+		if end == nil {
+			durations = append(durations, nil)
+		} else {
+			seconds := end.Sub(start).Seconds()
+			durations = append(durations, &seconds)
+		}
+	}
+	for i := range intervals {
+		interval := &intervals[i]
+		add(interval.start, &interval.end, &interval.value)
+		if i+1 == len(intervals) {
+			add(interval.end, nil, nil)
+		} else if next := intervals[i+1].start; interval.end.Before(next) {
+			add(interval.end, &next, nil)
+		}
+	}
+	hidden := map[string]interface{}{
+		"hideFrom": map[string]bool{"viz": true, "legend": true, "tooltip": false},
+	}
+	end := data.NewField("End", nil, ends)
+	end.Config = &data.FieldConfig{Custom: hidden}
+	duration := data.NewField("Duration", nil, durations)
+	duration.Config = &data.FieldConfig{Unit: "s", Custom: hidden}
+	state := data.NewField("State", labels, values)
+	state.Config = config
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, starts),
+		state,
+		end,
+		duration,
+	)
+}
+
+func formatStateTotalsQuery(queryName string, totals []stateTotals, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	days := []time.Time{}
+	hours := []float64{}
+	starts := []int64{}
+	for _, t := range totals {
+		days = append(days, t.day)
+		hours = append(hours, t.runningHours)
+		starts = append(starts, int64(t.starts))
+	}
+	runningHours := data.NewField("Running hours", labels, hours)
+	runningHours.Config = &data.FieldConfig{DisplayNameFromDS: config.DisplayNameFromDS + " running hours", Unit: "h"}
+	startCount := data.NewField("Starts", labels, starts)
+	startCount.Config = &data.FieldConfig{DisplayNameFromDS: config.DisplayNameFromDS + " starts"}
+	return data.NewFrame(queryName,
+		data.NewField("Time", nil, days),
+		runningHours,
+		startCount,
+	)
+}
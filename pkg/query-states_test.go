@@ -0,0 +1,40 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStatesGap(t *testing.T) {
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	// Running for two hours, a gap of three hours, and then stopped for two hours.
+	series := hourlySeries(start, 7, func(hour int) float64 { return []float64{1, 1, 0, 0, 0, 0, 0}[hour] })
+	series = append(series[:2], series[5:]...)
+	intervals := statesOf(&series, time.Hour, start.Add(10*time.Hour))
+	if len(intervals) != 2 || !intervals[0].end.Equal(start.Add(2*time.Hour)) || !intervals[1].start.Equal(start.Add(5*time.Hour)) {
+		t.Fatalf("statesOf() = %+v; expected two intervals around the gap", intervals)
+	}
+
+	frame := formatStatesQuery("A", intervals, nil, nil)
+	expected := []struct {
+		time  time.Time
+		state *float64
+	}{
+		{start, &intervals[0].value},
+		{start.Add(2 * time.Hour), nil},
+		{start.Add(5 * time.Hour), &intervals[1].value},
+		{start.Add(7 * time.Hour), nil},
+	}
+	if frame.Rows() != len(expected) {
+		t.Fatalf("formatStatesQuery() returned %d rows; expected %d", frame.Rows(), len(expected))
+	}
+	for i, row := range expected {
+		if tm := frame.Fields[0].At(i).(time.Time); !tm.Equal(row.time) {
+			t.Errorf("row %d at %v; expected %v", i, tm, row.time)
+		}
+		state := frame.Fields[1].At(i).(*float64)
+		if (state == nil) != (row.state == nil) || (state != nil && *state != *row.state) {
+			t.Errorf("row %d has the state %v; expected %v", i, state, row.state)
+		}
+	}
+}
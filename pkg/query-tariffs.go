@@ -0,0 +1,66 @@
+package main
+
+import (
+	"time"
+
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
+	"github.com/grafana/grafana-plugin-sdk-go/data"
+)
+
+// formatTimeOfUseQuery returns a field with the sums of each tariff bucket, and when the schedule has prices,
+// a cost field for each priced bucket and the total cost.
+func formatTimeOfUseQuery(queryName string, schedule model.TariffSchedule, usage []model.TimeOfUse, labels data.Labels, config *data.FieldConfig) *data.Frame {
+	times := make([]time.Time, 0, len(usage))
+	for _, u := range usage {
+		times = append(times, u.TS)
+	}
+	frame := data.NewFrame(queryName, data.NewField("Time", nil, times))
+
+	bucketField := func(name string, value func(u model.TimeOfUse) float64) *data.Field {
+		values := make([]float64, 0, len(usage))
+		for _, u := range usage {
+			values = append(values, value(u))
+		}
+		fieldLabels := data.Labels{"tariff": name}
+		for key, value := range labels {
+			fieldLabels[key] = value
+		}
+		return data.NewField(name, fieldLabels, values)
+	}
+
+	buckets := schedule.BucketNames()
+	for _, bucket := range buckets {
+		field := bucketField(bucket, func(u model.TimeOfUse) float64 {
+			return u.Buckets[bucket]
+		})
+		bucketConfig := *config
+		bucketConfig.DisplayNameFromDS = config.DisplayNameFromDS + " " + bucket
+		bucketConfig.Min, bucketConfig.Max = nil, nil
+		field.Config = &bucketConfig
+		frame.Fields = append(frame.Fields, field)
+	}
+	if len(schedule.Prices) == 0 {
+		return frame
+	}
+	for _, bucket := range buckets {
+		price, priced := schedule.Prices[bucket]
+		if !priced {
+			continue
+		}
+		field := bucketField(bucket+" cost", func(u model.TimeOfUse) float64 {
+			return u.Buckets[bucket] * price
+		})
+		field.Config = &data.FieldConfig{DisplayNameFromDS: config.DisplayNameFromDS + " " + bucket + " cost"}
+		frame.Fields = append(frame.Fields, field)
+	}
+	total := bucketField("Total cost", func(u model.TimeOfUse) float64 {
+		cost := 0.0
+		for bucket, value := range u.Buckets {
+			cost = cost + value*schedule.Prices[bucket]
+		}
+		return cost
+	})
+	total.Config = &data.FieldConfig{DisplayNameFromDS: config.DisplayNameFromDS + " total cost"}
+	frame.Fields = append(frame.Fields, total)
+	return frame
+}
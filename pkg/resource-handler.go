@@ -3,12 +3,15 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"net/url"
 	. "regexp"
 	"strings"
 
 	"github.com/Sensetif/sensetif-app-plugin/pkg/client"
 	"github.com/Sensetif/sensetif-app-plugin/pkg/handler"
+	"github.com/Sensetif/sensetif-app-plugin/pkg/model"
 	"github.com/grafana/grafana-plugin-sdk-go/backend"
 	"github.com/grafana/grafana-plugin-sdk-go/backend/log"
 )
@@ -30,6 +33,7 @@ const (
 	projectRegexName     = `[a-zA-Z][a-zA-Z0-9_.\-]*`
 	subsystemRegexName   = `[a-zA-Z][a-zA-Z0-9_.\-]*`
 	datapointRegexName   = `[a-zA-Z][a-zA-Z0-9_.\-$\[\]]*`
+	journalRegexName     = `[a-zA-Z][a-zA-Z0-9_.\-]*`
 )
 
 var links = []Link{
@@ -78,6 +82,17 @@ var links = []Link{
 	// Organizations API
 	{Method: "GET", Fn: handler.GetOrganization, Pattern: MustCompile(`^_organization$`)},
 
+	// Template Variables API
+	{Method: "GET", Fn: handler.FindVariableValues, Pattern: MustCompile(`^_variables$`)},
+
+	// Cache API
+	{Method: "GET", Fn: handler.CacheStatistics, Pattern: MustCompile(`^_cache/statistics$`)},
+
+	// Journals API
+	{Method: "GET", Fn: handler.ListJournals, Pattern: MustCompile(`^_journals/(` + journalRegexName + `)$`)},
+	{Method: "GET", Fn: handler.GetJournal, Pattern: MustCompile(`^_journals/(` + journalRegexName + `)/(` + journalRegexName + `)$`)},
+	{Method: "POST", Fn: handler.AddJournalEntry, Pattern: MustCompile(`^_journals/(` + journalRegexName + `)/(` + journalRegexName + `)$`)},
+
 	// Timeseries Update API
 	{Method: "PUT", Fn: handler.UpdateTimeseries, Pattern: MustCompile(`^_timeseries/(` + projectRegexName + `)/(` + subsystemRegexName + `)/(` + datapointRegexName + `)$`)},
 }
@@ -90,28 +105,36 @@ func (p *ResourceHandler) CallResource(_ context.Context, request *backend.CallR
 		return handleFileRequests(request, sender)
 	}
 
+	path, rawQuery, _ := strings.Cut(request.URL, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		log.DefaultLogger.With("error", err).Error("Invalid query string")
+	}
 	for _, link := range links {
 		if link.Method == request.Method {
-			parameters := link.Pattern.FindStringSubmatch(request.URL)
+			parameters := link.Pattern.FindStringSubmatch(path)
 			if len(parameters) >= 1 {
 				resourceRequest := handler.ResourceRequest{
 					Params: parameters,
+					Query:  query,
 					Body:   request.Body,
 				}
 
 				result, err := link.Fn(orgId, resourceRequest, p.Clients)
-				if err == nil {
-					log.DefaultLogger.Info("CallResource Result", "result", string(result.Body))
-					if result.Body == nil {
-						result.Body = []byte("{}") // Maybe we always need to return a json body?
-					}
-					sendErr := sender.Send(result)
-					if sendErr != nil {
-						log.DefaultLogger.With("error", sendErr).Error("could not write response to the client")
-						return sendErr
-					}
-					return nil
+				if err != nil {
+					log.DefaultLogger.With("error", err).Error("CallResource failed")
+					return sendError(err, sender)
+				}
+				log.DefaultLogger.Info("CallResource Result", "result", string(result.Body))
+				if result.Body == nil {
+					result.Body = []byte("{}") // Maybe we always need to return a json body?
+				}
+				sendErr := sender.Send(result)
+				if sendErr != nil {
+					log.DefaultLogger.With("error", sendErr).Error("could not write response to the client")
+					return sendErr
 				}
+				return nil
 			}
 		}
 	}
@@ -151,6 +174,27 @@ func notFound(message string, sender backend.CallResourceResponseSender) error {
 	})
 }
 
+// sendError responds with the status of the error returned by a handler. Only client errors carry the message,
+// since other errors can reveal internals.
+func sendError(err error, sender backend.CallResourceResponseSender) error {
+	status, message := http.StatusInternalServerError, model.ErrServerError.Error()
+	switch {
+	case errors.Is(err, model.ErrBadRequest):
+		status = http.StatusBadRequest
+	case errors.Is(err, model.ErrUnprocessableEntity):
+		status = http.StatusUnprocessableEntity
+	case errors.Is(err, model.ErrNotFound):
+		status = http.StatusNotFound
+	}
+	if status != http.StatusInternalServerError {
+		message = err.Error()
+	}
+	return sender.Send(&backend.CallResourceResponse{
+		Status: status,
+		Body:   createMessageJSON(message),
+	})
+}
+
 func createMessageJSON(message string) []byte {
 	response, _ := json.Marshal(struct {
 		Message string `json:"message"`